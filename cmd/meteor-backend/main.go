@@ -26,6 +26,9 @@ func main() {
 	if apiKey == "" {
 		log.Fatal("API_KEY environment variable is required")
 	}
+	if os.Getenv("PUBLIC_URL") == "" {
+		log.Println("PUBLIC_URL is not set, /search/google-maps will return results without a map")
+	}
 
 	log.Println("Starting meteor-backend server...")
 
@@ -38,6 +41,10 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// map images embedded in responses are loaded by discord without the api
+	// key, they carry a signature instead
+	r.Get("/utils/mapkit/image", handler.GetSignedMapKit)
+
 	r.Group(func(r chi.Router) {
 		r.Use(authmw.Auth(apiKey))
 
@@ -49,7 +56,7 @@ func main() {
 		r.Get("/omni/anime", handleNotImplemented)
 		r.Get("/omni/anime-supplemental", handleNotImplemented)
 		r.Get("/omni/manga", handleNotImplemented)
-		r.Get("/omni/movie", handleNotImplemented)
+		r.Get("/omni/movie", handler.SearchMovie)
 
 		r.Get("/search/duckduckgo", handler.SearchDuckDuckGo)
 		r.Get("/search/duckduckgo-images", handler.SearchDuckDuckGoImages)
@@ -58,41 +65,48 @@ func main() {
 		r.Get("/search/google-news", handler.SearchNews)
 		r.Get("/search/google-news-supplemental", handler.SearchNewsSupplemental)
 		r.Get("/search/lyrics", handler.SearchLyrics)
-		r.Get("/search/quora", handleNotImplemented)
-		r.Get("/search/quora-result", handleNotImplemented)
-		r.Get("/search/reverse-image", handleNotImplemented)
-		r.Get("/search/booru", handleNotImplemented)
+		r.Get("/search/quora", handler.SearchQuora)
+		r.Get("/search/quora-result", handler.SearchQuoraResult)
+		r.Get("/search/reverse-image", handler.SearchReverseImage)
+		r.Get("/search/booru", handler.SearchBooru)
+		r.Get("/search/booru-autocomplete", handler.SearchBooruAutocomplete)
 		r.Get("/search/urbandictionary", handler.SearchUrbanDictionary)
+		r.Get("/search/urbandictionary/random", handler.SearchUrbanDictionaryRandom)
+		r.Get("/search/urbandictionary/word-of-the-day", handler.SearchUrbanDictionaryWordOfTheDay)
+		r.Get("/search/urbandictionary/autocomplete", handler.SearchUrbanDictionaryAutocomplete)
 		r.Get("/search/weather", handler.SearchWeather)
+		r.Get("/search/air-quality", handler.SearchAirQuality)
 		r.Get("/search/wikihow", handler.SearchWikihow)
-		r.Get("/search/wolfram-alpha", handleNotImplemented)
-		r.Get("/search/wolfram-supplemental", handleNotImplemented)
+		r.Get("/search/wolfram-alpha", handler.SearchWolframAlpha)
+		r.Get("/search/wolfram-supplemental", handler.SearchWolframSupplemental)
 		r.Get("/search/youtube", handler.SearchYoutube)
 
-		r.Get("/tts/imtranslator", handleNotImplemented)
-		r.Get("/tts/moonbase", handleNotImplemented)
-		r.Get("/tts/playht", handleNotImplemented)
-		r.Get("/tts/tiktok", handleNotImplemented)
+		r.Get("/tts/imtranslator", handler.TTSImTranslator)
+		r.Get("/tts/moonbase", handler.TTSMoonbase)
+		r.Get("/tts/playht", handler.TTSPlayHT)
+		r.Get("/tts/tiktok", handler.TTSTikTok)
+		r.Get("/tts/voices", handler.GetTTSVoices)
 
-		r.Get("/utils/dictionary", handleNotImplemented)
+		r.Get("/utils/calculate", handler.Calculate)
+		r.Get("/utils/dictionary", handler.GetDictionaryV1)
 		r.Get("/utils/dictionary-v2", handler.GetDictionary)
-		r.Get("/utils/emojipedia", handleNotImplemented)
-		r.Get("/utils/emoji-search", handleNotImplemented)
+		r.Get("/utils/emojipedia", handler.GetEmojipedia)
+		r.Get("/utils/emoji-search", handler.SearchEmoji)
 		r.Get("/utils/garfield", handler.GetGarfield)
-		r.Get("/utils/gpt", handleNotImplemented)
-		r.Get("/utils/grok", handleNotImplemented)
-		r.Get("/utils/inferkit", handleNotImplemented)
-		r.Get("/utils/mapkit", handleNotImplemented)
+		r.Get("/utils/gpt", handler.GetGPT)
+		r.Get("/utils/grok", handler.GetGrok)
+		r.Get("/utils/inferkit", handler.GetInferKit)
+		r.Get("/utils/mapkit", handler.GetMapKit)
 		r.Get("/utils/otter", handler.GetOtter)
-		r.Get("/utils/perspective", handleNotImplemented)
+		r.Get("/utils/perspective", handler.GetPerspective)
 		r.Get("/utils/screenshot", handler.Screenshot)
-		r.Get("/utils/text-generator", handleNotImplemented)
+		r.Get("/utils/text-generator", handler.GetTextGenerator)
 		r.Get("/utils/unicode-metadata", handler.GetUnicodeMetadata)
 		r.Get("/utils/weather", handler.SearchWeather)
 		r.Get("/utils/webshot", handler.Webshot)
 
-		r.Get("/llm/_private:bard", handleNotImplemented)
-		r.Get("/parrot/google:gemini", handleNotImplemented)
+		r.Get("/llm/_private:bard", handler.GetBard)
+		r.Get("/parrot/google:gemini", handler.GetGemini)
 	})
 
 	port := ":8081"
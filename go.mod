@@ -7,6 +7,7 @@ require (
 	github.com/go-chi/chi/v5 v5.2.4
 	github.com/go-rod/rod v0.116.2
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/net v0.47.0
 	golang.org/x/text v0.33.0
 )
 
@@ -17,5 +18,4 @@ require (
 	github.com/ysmood/got v0.40.0 // indirect
 	github.com/ysmood/gson v0.7.3 // indirect
 	github.com/ysmood/leakless v0.9.0 // indirect
-	golang.org/x/net v0.47.0 // indirect
 )
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAirQualityDays = 3
+	maxAirQualityDays     = 5
+)
+
+// airQualityVariables are requested both as current values and hourly for
+// the forecast. pollen is only modelled for europe and null elsewhere.
+var airQualityVariables = []string{
+	"european_aqi", "us_aqi", "pm2_5", "pm10", "ozone", "nitrogen_dioxide",
+	"alder_pollen", "birch_pollen", "grass_pollen", "mugwort_pollen", "olive_pollen", "ragweed_pollen",
+}
+
+var airQualityPollutants = []string{"pm2_5", "pm10", "ozone", "nitrogen_dioxide"}
+
+type pollenType struct {
+	Name  string
+	Group string
+}
+
+var airQualityPollen = []pollenType{
+	{Name: "alder", Group: "tree"},
+	{Name: "birch", Group: "tree"},
+	{Name: "olive", Group: "tree"},
+	{Name: "grass", Group: "grass"},
+	{Name: "mugwort", Group: "weed"},
+	{Name: "ragweed", Group: "weed"},
+}
+
+// pollenThresholds are the national allergy bureau's lower bounds of the
+// moderate, high and very high levels in grains/m³, per plant group
+var pollenThresholds = map[string][3]float64{
+	"tree":  {15, 90, 1500},
+	"grass": {5, 20, 200},
+	"weed":  {10, 50, 500},
+}
+
+type aqiCategory struct {
+	Max    float64
+	Label  string
+	Advice string
+}
+
+var europeanAQICategories = []aqiCategory{
+	{20, "Good", "The air quality is good. Enjoy your usual outdoor activities."},
+	{40, "Fair", "Enjoy your usual outdoor activities."},
+	{60, "Moderate", "Enjoy your usual outdoor activities. Sensitive groups should consider reducing intense outdoor activities if they experience symptoms."},
+	{80, "Poor", "Consider reducing intense activities outdoors if you experience symptoms such as sore eyes, a cough or sore throat."},
+	{100, "Very poor", "Consider reducing intense activities outdoors. Sensitive groups should reduce physical activities outdoors."},
+	{-1, "Extremely poor", "Reduce physical activities outdoors. Sensitive groups should avoid them."},
+}
+
+var usAQICategories = []aqiCategory{
+	{50, "Good", "Air quality is satisfactory and poses little or no risk."},
+	{100, "Moderate", "Unusually sensitive people should consider reducing prolonged or heavy exertion outdoors."},
+	{150, "Unhealthy for sensitive groups", "People with heart or lung disease, older adults, children and teenagers should reduce prolonged or heavy exertion outdoors."},
+	{200, "Unhealthy", "Everyone should reduce prolonged or heavy exertion outdoors. Sensitive groups should avoid it."},
+	{300, "Very unhealthy", "Everyone should avoid prolonged or heavy exertion outdoors. Sensitive groups should stay indoors."},
+	{-1, "Hazardous", "Everyone should avoid all physical activity outdoors."},
+}
+
+func categorizeAQI(categories []aqiCategory, value float64) aqiCategory {
+	for _, c := range categories {
+		if c.Max < 0 || value <= c.Max {
+			return c
+		}
+	}
+	return categories[len(categories)-1]
+}
+
+func pollenLevel(group string, value float64) string {
+	thresholds := pollenThresholds[group]
+	switch {
+	case value <= 0:
+		return "none"
+	case value < thresholds[0]:
+		return "low"
+	case value < thresholds[1]:
+		return "moderate"
+	case value < thresholds[2]:
+		return "high"
+	}
+	return "very high"
+}
+
+// airQualityResponse keeps the variables by name, the values are null where
+// a model has no coverage
+type airQualityResponse struct {
+	openMeteoTimezone
+	Current map[string]interface{} `json:"current"`
+	Hourly  map[string]interface{} `json:"hourly"`
+}
+
+func (a *airQualityResponse) currentValue(name string) *float64 {
+	if v, ok := a.Current[name].(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+func (a *airQualityResponse) hourlySeries(name string) []*float64 {
+	raw, _ := a.Hourly[name].([]interface{})
+	series := make([]*float64, len(raw))
+	for i, v := range raw {
+		if f, ok := v.(float64); ok {
+			series[i] = &f
+		}
+	}
+	return series
+}
+
+func fetchAirQuality(loc geoLocation, days int) (*airQualityResponse, error) {
+	variables := strings.Join(airQualityVariables, ",")
+	params := url.Values{
+		"latitude":      {strconv.FormatFloat(loc.Latitude, 'f', 4, 64)},
+		"longitude":     {strconv.FormatFloat(loc.Longitude, 'f', 4, 64)},
+		"current":       {variables},
+		"hourly":        {variables},
+		"forecast_days": {strconv.Itoa(days)},
+		"timezone":      {"auto"},
+	}
+
+	// open-meteo reports bad requests as a 400 with {"error": true}, which
+	// fetchJSON turns into an error. an empty body is one too.
+	var aq airQualityResponse
+	if err := fetchJSON("https://air-quality-api.open-meteo.com/v1/air-quality?"+params.Encode(), &aq); err != nil {
+		return nil, err
+	}
+	if aq.Current == nil {
+		return nil, errors.New("air quality response has no current values")
+	}
+	return &aq, nil
+}
+
+func describeAQI(categories []aqiCategory, value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	category := categorizeAQI(categories, *value)
+	return map[string]interface{}{
+		"value":    *value,
+		"category": category.Label,
+		"advice":   category.Advice,
+	}
+}
+
+func describePollen(values map[string]*float64) map[string]interface{} {
+	pollen := map[string]interface{}{}
+	for _, p := range airQualityPollen {
+		value := values[p.Name]
+		if value == nil {
+			continue
+		}
+		pollen[p.Name] = map[string]interface{}{
+			"value": *value,
+			"level": pollenLevel(p.Group, *value),
+		}
+	}
+	return pollen
+}
+
+// buildAirQuality reports the current values and a daily forecast of the
+// worst hour of each day
+func buildAirQuality(aq *airQualityResponse, lang string) map[string]interface{} {
+	current := map[string]interface{}{
+		"european_aqi": describeAQI(europeanAQICategories, aq.currentValue("european_aqi")),
+		"us_aqi":       describeAQI(usAQICategories, aq.currentValue("us_aqi")),
+	}
+	if t, ok := aq.Current["time"].(string); ok {
+		current["time"] = parseTime(t, aq.location())
+	}
+	pollutants := map[string]interface{}{}
+	for _, name := range airQualityPollutants {
+		pollutants[name] = aq.currentValue(name)
+	}
+	current["pollutants"] = pollutants
+	pollen := map[string]*float64{}
+	for _, p := range airQualityPollen {
+		pollen[p.Name] = aq.currentValue(p.Name + "_pollen")
+	}
+	current["pollen"] = describePollen(pollen)
+
+	return map[string]interface{}{
+		"current":  current,
+		"forecast": buildAirQualityForecast(aq, lang),
+		"units": map[string]interface{}{
+			"pollutants": "μg/m³",
+			"pollen":     "grains/m³",
+		},
+	}
+}
+
+func buildAirQualityForecast(aq *airQualityResponse, lang string) []interface{} {
+	times, _ := aq.Hourly["time"].([]interface{})
+	series := map[string][]*float64{}
+	for _, name := range airQualityVariables {
+		series[name] = aq.hourlySeries(name)
+	}
+
+	// daily maxima, keyed by the local date the hourly times start with
+	var dates []string
+	maxima := map[string]map[string]*float64{}
+	for i, raw := range times {
+		t, _ := raw.(string)
+		if len(t) < 10 {
+			continue
+		}
+		date := t[:10]
+		day, ok := maxima[date]
+		if !ok {
+			day = map[string]*float64{}
+			maxima[date] = day
+			dates = append(dates, date)
+		}
+		for name, values := range series {
+			if i >= len(values) || values[i] == nil {
+				continue
+			}
+			if day[name] == nil || *values[i] > *day[name] {
+				day[name] = values[i]
+			}
+		}
+	}
+
+	now := time.Now().In(aq.location())
+	forecast := []interface{}{}
+	for _, date := range dates {
+		t, dayName, ok := forecastDay(date, now, lang)
+		if !ok {
+			continue
+		}
+		day := maxima[date]
+
+		pollutants := map[string]interface{}{}
+		for _, name := range airQualityPollutants {
+			pollutants[name] = day[name]
+		}
+		pollen := map[string]*float64{}
+		for _, p := range airQualityPollen {
+			pollen[p.Name] = day[p.Name+"_pollen"]
+		}
+
+		forecast = append(forecast, map[string]interface{}{
+			"day":          dayName,
+			"date":         date,
+			"timestamp":    t.UnixMilli(),
+			"european_aqi": describeAQI(europeanAQICategories, day["european_aqi"]),
+			"us_aqi":       describeAQI(usAQICategories, day["us_aqi"]),
+			"pollutants":   pollutants,
+			"pollen":       describePollen(pollen),
+		})
+	}
+	return forecast
+}
+
+func SearchAirQuality(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+	query := r.URL.Query()
+
+	days := defaultAirQualityDays
+	if raw := query.Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAirQualityDays {
+			rw.writeError(StatusError, fmt.Sprintf("invalid 'days' query parameter %q, expected 1 to %d", raw, maxAirQualityDays))
+			return
+		}
+		days = n
+	}
+	lang := weatherLanguage(query.Get("lang"))
+
+	loc, err := resolveWeatherLocation(query, lang)
+	if err != nil {
+		writeLocationError(rw, err)
+		return
+	}
+
+	aq, err := fetchAirQuality(loc.geoLocation, days)
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch air quality")
+		return
+	}
+
+	result := buildAirQuality(aq, lang)
+	result["location"] = loc.Name
+	result["place"] = describeGeoLocation(loc.geoLocation)
+	result["timezone"] = aq.openMeteoTimezone.describe()
+
+	response := map[string]interface{}{
+		"status": StatusSuccess,
+		"result": result,
+	}
+	loc.addCandidates(response)
+	rw.write(response)
+}
@@ -0,0 +1,478 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	articleMaxBytes          = 5 << 20
+	articleDefaultParagraphs = 3
+	articleMaxParagraphs     = 10
+	articleMinParagraphChars = 40
+)
+
+var (
+	articleUnlikely = regexp.MustCompile(`(?i)comment|sidebar|footer|foot|nav|menu|share|social|related|recommend|promo|sponsor|advert|\bads?\b|subscribe|newsletter|cookie|consent|popup|modal|banner|breadcrumb|byline|caption|masthead|outbrain|taboola`)
+	articleLikely   = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|prose`)
+)
+
+type articleMetadata struct {
+	Headline    string
+	Description string
+	Byline      string
+	Published   string
+	Image       string
+	SiteName    string
+}
+
+type articleLDAuthor struct {
+	Name string `json:"name"`
+}
+
+type articleLD struct {
+	Type          json.RawMessage `json:"@type"`
+	Headline      string          `json:"headline"`
+	Description   string          `json:"description"`
+	DatePublished string          `json:"datePublished"`
+	Author        json.RawMessage `json:"author"`
+	Image         json.RawMessage `json:"image"`
+	Publisher     struct {
+		Name string `json:"name"`
+	} `json:"publisher"`
+	Graph []articleLD `json:"@graph"`
+}
+
+func (a articleLD) isArticle() bool {
+	var types []string
+	var single string
+	if err := json.Unmarshal(a.Type, &single); err == nil {
+		types = []string{single}
+	} else {
+		json.Unmarshal(a.Type, &types)
+	}
+	for _, t := range types {
+		if strings.HasSuffix(t, "Article") || t == "BlogPosting" {
+			return true
+		}
+	}
+	return false
+}
+
+// ldAuthors handles authors given as a name, an object or a list of either.
+func ldAuthors(raw json.RawMessage) []string {
+	var name string
+	if json.Unmarshal(raw, &name) == nil && name != "" {
+		return []string{name}
+	}
+	var single articleLDAuthor
+	if json.Unmarshal(raw, &single) == nil && single.Name != "" {
+		return []string{single.Name}
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) != nil {
+		return nil
+	}
+	var names []string
+	for _, item := range list {
+		names = append(names, ldAuthors(item)...)
+	}
+	return names
+}
+
+// ldImage handles images given as a url, an ImageObject or a list of either.
+func ldImage(raw json.RawMessage) string {
+	var src string
+	if json.Unmarshal(raw, &src) == nil {
+		return src
+	}
+	var object struct {
+		URL string `json:"url"`
+	}
+	if json.Unmarshal(raw, &object) == nil && object.URL != "" {
+		return object.URL
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil && len(list) > 0 {
+		return ldImage(list[0])
+	}
+	return ""
+}
+
+func findArticleLD(doc *goquery.Document) *articleLD {
+	var found *articleLD
+	var check func(candidates []articleLD)
+	check = func(candidates []articleLD) {
+		for i := range candidates {
+			if found != nil {
+				return
+			}
+			if candidates[i].isArticle() {
+				found = &candidates[i]
+				return
+			}
+			check(candidates[i].Graph)
+		}
+	}
+
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		raw := []byte(s.Text())
+		var single articleLD
+		if err := json.Unmarshal(raw, &single); err == nil {
+			check([]articleLD{single})
+		} else {
+			var list []articleLD
+			if json.Unmarshal(raw, &list) == nil {
+				check(list)
+			}
+		}
+		return found == nil
+	})
+	return found
+}
+
+func metaContent(doc *goquery.Document, names ...string) string {
+	for _, name := range names {
+		selector := fmt.Sprintf(`meta[property="%[1]s"], meta[name="%[1]s"], meta[itemprop="%[1]s"]`, name)
+		if content := strings.TrimSpace(doc.Find(selector).First().AttrOr("content", "")); content != "" {
+			return content
+		}
+	}
+	return ""
+}
+
+func extractArticleMetadata(doc *goquery.Document) articleMetadata {
+	meta := articleMetadata{
+		Headline:    metaContent(doc, "og:title", "twitter:title"),
+		Description: metaContent(doc, "og:description", "twitter:description", "description"),
+		Published:   metaContent(doc, "article:published_time", "datePublished", "pubdate", "publishdate", "date", "dc.date", "DC.date.issued"),
+		Image:       metaContent(doc, "og:image", "og:image:url", "twitter:image", "twitter:image:src"),
+		SiteName:    metaContent(doc, "og:site_name", "application-name"),
+	}
+
+	if ld := findArticleLD(doc); ld != nil {
+		if ld.Headline != "" {
+			meta.Headline = ld.Headline
+		}
+		if meta.Description == "" {
+			meta.Description = ld.Description
+		}
+		if ld.DatePublished != "" {
+			meta.Published = ld.DatePublished
+		}
+		if authors := ldAuthors(ld.Author); len(authors) > 0 {
+			meta.Byline = strings.Join(authors, ", ")
+		}
+		if meta.Image == "" {
+			meta.Image = ldImage(ld.Image)
+		}
+		if meta.SiteName == "" {
+			meta.SiteName = ld.Publisher.Name
+		}
+	}
+
+	if meta.Byline == "" {
+		// article:author is often a profile url rather than a name
+		if author := metaContent(doc, "author", "article:author", "byl"); author != "" && !strings.HasPrefix(author, "http") {
+			meta.Byline = strings.TrimPrefix(author, "By ")
+		}
+	}
+	if meta.Byline == "" {
+		byline := doc.Find(`[rel="author"], [itemprop="author"], .byline, [class*="byline"], [class*="author-name"]`).First().Text()
+		meta.Byline = strings.TrimPrefix(strings.Join(strings.Fields(byline), " "), "By ")
+	}
+
+	if meta.Headline == "" {
+		meta.Headline = strings.TrimSpace(doc.Find("h1").First().Text())
+	}
+	if meta.Headline == "" {
+		meta.Headline = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	if meta.Published == "" {
+		meta.Published = doc.Find("time[datetime]").First().AttrOr("datetime", "")
+	}
+
+	return meta
+}
+
+func articleText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(articleText(s))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(i int, a *goquery.Selection) {
+		links += len(articleText(a))
+	})
+	return float64(links) / float64(total)
+}
+
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, attr := range []string{"class", "id"} {
+		value := s.AttrOr(attr, "")
+		if value == "" {
+			continue
+		}
+		if articleUnlikely.MatchString(value) {
+			weight -= 25
+		}
+		if articleLikely.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+func tagWeight(node *html.Node) float64 {
+	switch node.Data {
+	case "article":
+		return 10
+	case "div", "section", "main":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form", "address":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+	return 0
+}
+
+// findArticleBody scores containers by the paragraphs they hold, the way
+// readability does: every paragraph adds to its parent and, at half weight,
+// its grandparent, then link heavy containers are penalized.
+func findArticleBody(doc *goquery.Document) *goquery.Selection {
+	doc.Find("script, style, noscript, template, iframe, svg, form, nav, header, footer, aside, button").Remove()
+	doc.Find("*").Each(func(i int, s *goquery.Selection) {
+		id := s.AttrOr("class", "") + " " + s.AttrOr("id", "")
+		if strings.TrimSpace(id) == "" || s.Is("body, article, main") {
+			return
+		}
+		if articleUnlikely.MatchString(id) && !articleLikely.MatchString(id) {
+			s.Remove()
+		}
+	})
+
+	scores := map[*html.Node]float64{}
+	addScore := func(s *goquery.Selection, score float64) {
+		if s.Length() == 0 {
+			return
+		}
+		node := s.Get(0)
+		if _, ok := scores[node]; !ok {
+			scores[node] = tagWeight(node) + classWeight(s)
+		}
+		scores[node] += score
+	}
+
+	doc.Find("p, pre, td").Each(func(i int, p *goquery.Selection) {
+		text := articleText(p)
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		addScore(p.Parent(), score)
+		addScore(p.Parent().Parent(), score/2)
+	})
+
+	// candidates are compared in document order, so ties always go to the
+	// outermost and earliest one
+	var best *goquery.Selection
+	bestScore := 0.0
+	doc.Find("*").Each(func(i int, s *goquery.Selection) {
+		score, ok := scores[s.Get(0)]
+		if !ok {
+			return
+		}
+		score *= 1 - linkDensity(s)
+		if best == nil || score > bestScore {
+			best, bestScore = s, score
+		}
+	})
+	if best == nil {
+		return doc.Find("body")
+	}
+	return best
+}
+
+type articleContent struct {
+	Paragraphs []string
+	WordCount  int
+	Image      string
+}
+
+func extractArticleContent(doc *goquery.Document) articleContent {
+	var content articleContent
+	body := findArticleBody(doc)
+
+	body.Find("p").Each(func(i int, p *goquery.Selection) {
+		text := articleText(p)
+		if len(text) < articleMinParagraphChars || linkDensity(p) > 0.5 {
+			return
+		}
+		content.Paragraphs = append(content.Paragraphs, text)
+		content.WordCount += len(strings.Fields(text))
+	})
+
+	body.Find("img").EachWithBreak(func(i int, img *goquery.Selection) bool {
+		src := img.AttrOr("src", img.AttrOr("data-src", ""))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return true
+		}
+		// tiny images are tracking pixels and icons
+		if width, err := strconv.Atoi(img.AttrOr("width", "")); err == nil && width < 200 {
+			return true
+		}
+		content.Image = src
+		return false
+	})
+
+	return content
+}
+
+// parseArticleDate normalizes the many date formats found in article
+// metadata to RFC 3339.
+func parseArticleDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{
+		time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00",
+		"2006-01-02 15:04:05", time.RFC1123Z, time.RFC1123, "2006-01-02", "January 2, 2006",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+func resolveArticleURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// fetchArticleDocument returns the parsed page along with the url it ended
+// up at after redirects, which relative links are resolved against.
+func fetchArticleDocument(pageURL string) (*goquery.Document, *url.URL, error) {
+	resp, err := fetchResponse(context.Background(), ddgClient, pageURL, getDDGHeaders())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, nil, errors.New("url is not a html page")
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, articleMaxBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, resp.Request.URL, nil
+}
+
+func SearchNewsSupplemental(w http.ResponseWriter, r *http.Request) {
+	pageURL := r.URL.Query().Get("url")
+	if pageURL == "" {
+		writeSearchJSONError(w, StatusError, "missing 'url' query parameter")
+		return
+	}
+	if parsed, err := url.Parse(pageURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		writeSearchJSONError(w, StatusError, "invalid 'url' query parameter")
+		return
+	}
+	// google news links only redirect with javascript
+	resolved, err := resolveGoogleNewsURL(r.Context(), pageURL)
+	if err != nil {
+		writeSearchJSONError(w, StatusError, "failed to resolve google news article")
+		return
+	}
+	pageURL = resolved
+
+	paragraphs := articleDefaultParagraphs
+	if v := r.URL.Query().Get("paragraphs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeSearchJSONError(w, StatusError, "invalid 'paragraphs' query parameter")
+			return
+		}
+		paragraphs = min(n, articleMaxParagraphs)
+	}
+
+	doc, finalURL, err := fetchArticleDocument(pageURL)
+	if err != nil {
+		if isNotFoundError(err) {
+			writeSearchJSONError(w, StatusNotFound, "article not found")
+			return
+		}
+		writeSearchJSONError(w, StatusError, "failed to fetch article")
+		return
+	}
+
+	// metadata has to be read first, content extraction strips the page
+	meta := extractArticleMetadata(doc)
+	content := extractArticleContent(doc)
+
+	if len(content.Paragraphs) == 0 && meta.Description == "" {
+		writeSearchJSONError(w, StatusNotFound, "no article content found")
+		return
+	}
+
+	image := meta.Image
+	if image == "" {
+		image = content.Image
+	}
+	siteName := meta.SiteName
+	if siteName == "" {
+		siteName = finalURL.Hostname()
+	}
+
+	firstParagraphs := content.Paragraphs
+	if len(firstParagraphs) > paragraphs {
+		firstParagraphs = firstParagraphs[:paragraphs]
+	}
+	if firstParagraphs == nil {
+		firstParagraphs = []string{}
+	}
+
+	writeSearchJSON(w, map[string]interface{}{
+		"status": StatusSuccess,
+		"article": map[string]interface{}{
+			"url":         finalURL.String(),
+			"headline":    meta.Headline,
+			"description": meta.Description,
+			"byline":      meta.Byline,
+			"published":   parseArticleDate(meta.Published),
+			"image":       resolveArticleURL(finalURL, image),
+			"publisher": map[string]interface{}{
+				"name": siteName,
+				"icon": fmt.Sprintf("https://www.google.com/s2/favicons?domain=%s&sz=64", finalURL.Hostname()),
+			},
+			"word_count": content.WordCount,
+			"paragraphs": firstParagraphs,
+		},
+	})
+}
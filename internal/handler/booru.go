@@ -0,0 +1,452 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BooruRatingGeneral      = "general"
+	BooruRatingSensitive    = "sensitive"
+	BooruRatingQuestionable = "questionable"
+	BooruRatingExplicit     = "explicit"
+)
+
+const (
+	booruDefaultLimit = 20
+	booruMaxLimit     = 100
+)
+
+var booruHeaders = map[string]string{
+	"User-Agent": "MeteorDiscordBot/1.0",
+	"Accept":     "application/json",
+}
+
+type booruPost struct {
+	ID      int      `json:"id"`
+	URL     string   `json:"url"`
+	Image   string   `json:"image"`
+	Sample  string   `json:"sample"`
+	Preview string   `json:"preview"`
+	Tags    []string `json:"tags"`
+	Rating  string   `json:"rating"`
+	Score   int      `json:"score"`
+	Source  string   `json:"source"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+}
+
+type booruTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// booruSite is implemented by every imageboard API supported by /search/booru.
+type booruSite interface {
+	search(tags []string, page, limit int) ([]booruPost, error)
+	autocomplete(query string) ([]booruTag, error)
+	// safeTag is the rating metatag that restricts a query to safe posts.
+	safeTag() string
+}
+
+func newBooruSite(name string) (booruSite, bool) {
+	switch name {
+	case "danbooru":
+		return &danbooruSite{baseURL: "https://danbooru.donmai.us"}, true
+	case "gelbooru":
+		return &gelbooruSite{
+			baseURL:   "https://gelbooru.com",
+			apiKey:    os.Getenv("GELBOORU_API_KEY"),
+			userID:    os.Getenv("GELBOORU_USER_ID"),
+			ratingTag: "rating:general",
+		}, true
+	case "safebooru":
+		return &gelbooruSite{
+			baseURL:   "https://safebooru.org",
+			ratingTag: "rating:safe",
+		}, true
+	}
+	return nil, false
+}
+
+func normalizeBooruRating(rating string) string {
+	// danbooru uses single letters where "s" is sensitive, the gelbooru
+	// family spells ratings out and older boards still use "safe"
+	switch strings.ToLower(rating) {
+	case "g", "general", "safe":
+		return BooruRatingGeneral
+	case "s", "sensitive":
+		return BooruRatingSensitive
+	case "q", "questionable":
+		return BooruRatingQuestionable
+	case "e", "explicit":
+		return BooruRatingExplicit
+	}
+	return ""
+}
+
+func isSafeBooruRating(rating string) bool {
+	return rating == BooruRatingGeneral
+}
+
+// booruNSFWAllowed reports whether the API key is allowed to receive nsfw
+// posts at all. Requests still have to opt in with nsfw=true.
+func booruNSFWAllowed() bool {
+	return os.Getenv("ALLOW_NSFW") == "true"
+}
+
+type danbooruSite struct {
+	baseURL string
+}
+
+type danbooruPost struct {
+	ID             int    `json:"id"`
+	FileURL        string `json:"file_url"`
+	LargeFileURL   string `json:"large_file_url"`
+	PreviewFileURL string `json:"preview_file_url"`
+	TagString      string `json:"tag_string"`
+	Rating         string `json:"rating"`
+	Score          int    `json:"score"`
+	Source         string `json:"source"`
+	ImageWidth     int    `json:"image_width"`
+	ImageHeight    int    `json:"image_height"`
+}
+
+func (d *danbooruSite) safeTag() string {
+	return "rating:g"
+}
+
+func (d *danbooruSite) search(tags []string, page, limit int) ([]booruPost, error) {
+	apiURL := fmt.Sprintf(
+		"%s/posts.json?tags=%s&page=%d&limit=%d",
+		d.baseURL, url.QueryEscape(strings.Join(tags, " ")), page, limit,
+	)
+
+	var posts []danbooruPost
+	if err := fetchJSONWithHeaders(apiURL, booruHeaders, &posts); err != nil {
+		return nil, err
+	}
+
+	results := make([]booruPost, 0, len(posts))
+	for _, p := range posts {
+		// posts restricted to gold accounts come back without any file urls
+		if p.FileURL == "" {
+			continue
+		}
+		results = append(results, booruPost{
+			ID:      p.ID,
+			URL:     fmt.Sprintf("%s/posts/%d", d.baseURL, p.ID),
+			Image:   p.FileURL,
+			Sample:  p.LargeFileURL,
+			Preview: p.PreviewFileURL,
+			Tags:    strings.Fields(p.TagString),
+			Rating:  normalizeBooruRating(p.Rating),
+			Score:   p.Score,
+			Source:  p.Source,
+			Width:   p.ImageWidth,
+			Height:  p.ImageHeight,
+		})
+	}
+	return results, nil
+}
+
+func (d *danbooruSite) autocomplete(query string) ([]booruTag, error) {
+	apiURL := fmt.Sprintf(
+		"%s/tags.json?search[name_matches]=%s&search[order]=count&limit=10",
+		d.baseURL, url.QueryEscape(query+"*"),
+	)
+
+	var tags []struct {
+		Name      string `json:"name"`
+		PostCount int    `json:"post_count"`
+	}
+	if err := fetchJSONWithHeaders(apiURL, booruHeaders, &tags); err != nil {
+		return nil, err
+	}
+
+	results := make([]booruTag, 0, len(tags))
+	for _, t := range tags {
+		results = append(results, booruTag{Name: t.Name, Count: t.PostCount})
+	}
+	return results, nil
+}
+
+// gelbooruSite covers every board running the gelbooru dapi, which includes
+// safebooru.
+type gelbooruSite struct {
+	baseURL   string
+	apiKey    string
+	userID    string
+	ratingTag string
+}
+
+type gelbooruPost struct {
+	ID         int    `json:"id"`
+	FileURL    string `json:"file_url"`
+	SampleURL  string `json:"sample_url"`
+	PreviewURL string `json:"preview_url"`
+	Directory  string `json:"directory"`
+	Image      string `json:"image"`
+	Hash       string `json:"hash"`
+	Sample     any    `json:"sample"`
+	Tags       string `json:"tags"`
+	Rating     string `json:"rating"`
+	Score      int    `json:"score"`
+	Source     string `json:"source"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+}
+
+func (g *gelbooruSite) safeTag() string {
+	return g.ratingTag
+}
+
+func (g *gelbooruSite) dapiURL(params url.Values) string {
+	params.Set("page", "dapi")
+	params.Set("q", "index")
+	params.Set("json", "1")
+	if g.apiKey != "" && g.userID != "" {
+		params.Set("api_key", g.apiKey)
+		params.Set("user_id", g.userID)
+	}
+	return fmt.Sprintf("%s/index.php?%s", g.baseURL, params.Encode())
+}
+
+func (g *gelbooruSite) search(tags []string, page, limit int) ([]booruPost, error) {
+	params := url.Values{}
+	params.Set("s", "post")
+	params.Set("tags", strings.Join(tags, " "))
+	params.Set("limit", strconv.Itoa(limit))
+	// gelbooru pages are zero-indexed
+	params.Set("pid", strconv.Itoa(page-1))
+
+	body, err := fetchBytesWithHeaders(g.dapiURL(params), booruHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	// gelbooru wraps posts in an object, safebooru returns a bare array and
+	// an empty body when nothing matches
+	var posts []gelbooruPost
+	trimmed := strings.TrimSpace(string(body))
+	switch {
+	case trimmed == "":
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal(body, &posts); err != nil {
+			return nil, err
+		}
+	default:
+		var wrapped struct {
+			Post []gelbooruPost `json:"post"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, err
+		}
+		posts = wrapped.Post
+	}
+
+	results := make([]booruPost, 0, len(posts))
+	for _, p := range posts {
+		image := p.FileURL
+		if image == "" && p.Directory != "" {
+			image = fmt.Sprintf("%s/images/%s/%s", g.baseURL, p.Directory, p.Image)
+		}
+		if image == "" {
+			continue
+		}
+
+		sample := p.SampleURL
+		if sample == "" {
+			sample = image
+			if hasSample, _ := p.Sample.(bool); hasSample || p.Sample == float64(1) {
+				sample = fmt.Sprintf("%s/samples/%s/sample_%s.jpg", g.baseURL, p.Directory, p.Hash)
+			}
+		}
+
+		preview := p.PreviewURL
+		if preview == "" && p.Directory != "" {
+			preview = fmt.Sprintf("%s/thumbnails/%s/thumbnail_%s.jpg", g.baseURL, p.Directory, p.Hash)
+		}
+
+		results = append(results, booruPost{
+			ID:      p.ID,
+			URL:     fmt.Sprintf("%s/index.php?page=post&s=view&id=%d", g.baseURL, p.ID),
+			Image:   image,
+			Sample:  sample,
+			Preview: preview,
+			Tags:    strings.Fields(p.Tags),
+			Rating:  normalizeBooruRating(p.Rating),
+			Score:   p.Score,
+			Source:  p.Source,
+			Width:   p.Width,
+			Height:  p.Height,
+		})
+	}
+	return results, nil
+}
+
+func (g *gelbooruSite) autocomplete(query string) ([]booruTag, error) {
+	params := url.Values{}
+	params.Set("s", "tag")
+	params.Set("name_pattern", query+"%")
+	params.Set("orderby", "count")
+	params.Set("limit", "10")
+
+	body, err := fetchBytesWithHeaders(g.dapiURL(params), booruHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	type gelbooruTag struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	var tags []gelbooruTag
+	trimmed := strings.TrimSpace(string(body))
+	switch {
+	case trimmed == "":
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal(body, &tags); err != nil {
+			return nil, err
+		}
+	default:
+		var wrapped struct {
+			Tag []gelbooruTag `json:"tag"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, err
+		}
+		tags = wrapped.Tag
+	}
+
+	results := make([]booruTag, 0, len(tags))
+	for _, t := range tags {
+		results = append(results, booruTag{Name: t.Name, Count: t.Count})
+	}
+	return results, nil
+}
+
+// sanitizeBooruTags drops any user supplied rating metatags when nsfw is not
+// allowed, so a query can never ask the upstream for unsafe posts.
+func sanitizeBooruTags(query string, nsfw bool) []string {
+	var tags []string
+	for _, tag := range strings.Fields(query) {
+		lower := strings.ToLower(strings.TrimPrefix(tag, "-"))
+		if !nsfw && strings.HasPrefix(lower, "rating:") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func getBooruSite(r *http.Request) (booruSite, string, bool) {
+	name := strings.ToLower(r.URL.Query().Get("site"))
+	if name == "" {
+		name = "safebooru"
+	}
+	site, ok := newBooruSite(name)
+	return site, name, ok
+}
+
+func SearchBooru(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	site, siteName, ok := getBooruSite(r)
+	if !ok {
+		rw.writeError(StatusError, "unsupported 'site' query parameter")
+		return
+	}
+
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 0 {
+		page = p
+	}
+
+	limit := booruDefaultLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, booruMaxLimit)
+	}
+
+	nsfw := booruNSFWAllowed() && r.URL.Query().Get("nsfw") == "true"
+
+	tags := sanitizeBooruTags(query, nsfw)
+	if !nsfw {
+		tags = append(tags, site.safeTag())
+	}
+
+	posts, err := site.search(tags, page, limit)
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch booru results")
+		return
+	}
+
+	// the rating tag above is only a hint for the upstream, this is the
+	// actual enforcement
+	results := make([]booruPost, 0, len(posts))
+	for _, post := range posts {
+		if !nsfw && !isSafeBooruRating(post.Rating) {
+			continue
+		}
+		results = append(results, post)
+	}
+
+	if len(results) == 0 {
+		rw.writeError(StatusNotFound, "no results found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"site":    siteName,
+		"nsfw":    nsfw,
+		"page":    page,
+		"results": results,
+	})
+}
+
+func SearchBooruAutocomplete(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	site, siteName, ok := getBooruSite(r)
+	if !ok {
+		rw.writeError(StatusError, "unsupported 'site' query parameter")
+		return
+	}
+
+	tags, err := site.autocomplete(strings.ReplaceAll(query, " ", "_"))
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch tag suggestions")
+		return
+	}
+
+	if len(tags) == 0 {
+		rw.writeError(StatusNotFound, "no tags found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"site":    siteName,
+		"results": tags,
+	})
+}
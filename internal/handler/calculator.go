@@ -0,0 +1,564 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	calcPrecision = 256
+
+	calcMaxExactPower     = 100000
+	calcMaxFactorial      = 5000
+	calcMaxExactIntDigits = 70
+	calcSignificantDigits = 15
+)
+
+var (
+	errCalcSyntax    = errors.New("invalid expression")
+	errCalcDivByZero = errors.New("division by zero")
+	errCalcDomain    = errors.New("value out of domain")
+)
+
+var calcConstants = map[string]float64{
+	"pi":  math.Pi,
+	"π":   math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+	"τ":   2 * math.Pi,
+	"phi": math.Phi,
+	"φ":   math.Phi,
+}
+
+var calcFunctions = map[string]func(float64) float64{
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+	"sinh":  math.Sinh,
+	"cosh":  math.Cosh,
+	"tanh":  math.Tanh,
+	"sqrt":  math.Sqrt,
+	"cbrt":  math.Cbrt,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log2":  math.Log2,
+	"log10": math.Log10,
+	"exp":   math.Exp,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"deg":   func(x float64) float64 { return x * 180 / math.Pi },
+	"rad":   func(x float64) float64 { return x * math.Pi / 180 },
+}
+
+type calcTokenKind int
+
+const (
+	calcTokenNumber calcTokenKind = iota
+	calcTokenIdent
+	calcTokenOp
+	calcTokenLParen
+	calcTokenRParen
+	calcTokenComma
+)
+
+type calcToken struct {
+	kind  calcTokenKind
+	text  string
+	value *big.Float
+}
+
+func newCalcFloat() *big.Float {
+	return new(big.Float).SetPrec(calcPrecision)
+}
+
+// calcFinite rejects results past big.Float's exponent range. they turn into
+// infinities, and math/big panics on Inf-Inf or 0*Inf further on.
+func calcFinite(value *big.Float) (*big.Float, error) {
+	if value.IsInf() {
+		return nil, errCalcDomain
+	}
+	return value, nil
+}
+
+// calcIsSmallInt is whether value can be turned into a big.Int without
+// allocating for a huge exponent
+func calcIsSmallInt(value *big.Float) bool {
+	return value.IsInt() && value.MantExp(nil) <= calcPrecision
+}
+
+func tokenizeExpression(expr string) ([]calcToken, error) {
+	replacer := strings.NewReplacer("×", "*", "÷", "/", "−", "-", "**", "^", "√", "sqrt")
+	runes := []rune(replacer.Replace(expr))
+
+	var tokens []calcToken
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == '_') {
+				i++
+			}
+			// scientific notation, only when followed by a digit so "2e" stays 2*e
+			if i+1 < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if runes[j] == '+' || runes[j] == '-' {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					i = j
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			text := strings.ReplaceAll(string(runes[start:i]), "_", "")
+			value, ok := newCalcFloat().SetString(text)
+			if !ok {
+				return nil, errCalcSyntax
+			}
+			tokens = append(tokens, calcToken{kind: calcTokenNumber, text: text, value: value})
+		case unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, calcToken{kind: calcTokenIdent, text: strings.ToLower(string(runes[start:i]))})
+		case strings.ContainsRune("+-*/%^!", c):
+			tokens = append(tokens, calcToken{kind: calcTokenOp, text: string(c)})
+			i++
+		case c == '(':
+			tokens = append(tokens, calcToken{kind: calcTokenLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, calcToken{kind: calcTokenRParen, text: ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, calcToken{kind: calcTokenComma, text: ","})
+			i++
+		default:
+			return nil, errCalcSyntax
+		}
+	}
+	return tokens, nil
+}
+
+// calcParser is a recursive descent parser that evaluates while parsing.
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary | unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = postfix [ "^" unary ]
+//	postfix = primary { "!" }
+//	primary = number | constant | function "(" expr ")" | "(" expr ")"
+type calcParser struct {
+	tokens []calcToken
+	pos    int
+}
+
+func (p *calcParser) peek() *calcToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *calcParser) peekOp(ops string) string {
+	tok := p.peek()
+	if tok != nil && tok.kind == calcTokenOp && strings.Contains(ops, tok.text) {
+		return tok.text
+	}
+	return ""
+}
+
+func (p *calcParser) parseExpr() (*big.Float, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp("+-")
+		if op == "" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			left, err = calcFinite(newCalcFloat().Add(left, right))
+		} else {
+			left, err = calcFinite(newCalcFloat().Sub(left, right))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *calcParser) parseTerm() (*big.Float, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp("*/%")
+		if op == "" {
+			// implicit multiplication such as "2pi" or "3(4+1)"
+			tok := p.peek()
+			if tok == nil || (tok.kind != calcTokenNumber && tok.kind != calcTokenIdent && tok.kind != calcTokenLParen) {
+				return left, nil
+			}
+			op = "*"
+		} else {
+			p.pos++
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "*":
+			left, err = calcFinite(newCalcFloat().Mul(left, right))
+		case "/":
+			if right.Sign() == 0 {
+				return nil, errCalcDivByZero
+			}
+			left, err = calcFinite(newCalcFloat().Quo(left, right))
+		case "%":
+			if right.Sign() == 0 {
+				return nil, errCalcDivByZero
+			}
+			left, err = calcMod(left, right)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *calcParser) parseUnary() (*big.Float, error) {
+	if op := p.peekOp("+-"); op != "" {
+		p.pos++
+		value, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "-" {
+			return newCalcFloat().Neg(value), nil
+		}
+		return value, nil
+	}
+	return p.parsePower()
+}
+
+func (p *calcParser) parsePower() (*big.Float, error) {
+	base, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if p.peekOp("^") == "" {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return calcPow(base, exponent)
+}
+
+func (p *calcParser) parsePostfix() (*big.Float, error) {
+	value, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("!") != "" {
+		p.pos++
+		value, err = calcFactorial(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func (p *calcParser) parsePrimary() (*big.Float, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, errCalcSyntax
+	}
+	p.pos++
+
+	switch tok.kind {
+	case calcTokenNumber:
+		return tok.value, nil
+	case calcTokenLParen:
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next == nil || next.kind != calcTokenRParen {
+			return nil, errCalcSyntax
+		}
+		p.pos++
+		return value, nil
+	case calcTokenIdent:
+		if c, ok := calcConstants[tok.text]; ok {
+			return newCalcFloat().SetFloat64(c), nil
+		}
+		fn, ok := calcFunctions[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown identifier %q", tok.text)
+		}
+		// functions accept either "sqrt(2)" or "sqrt 2"
+		var arg *big.Float
+		var err error
+		if next := p.peek(); next != nil && next.kind == calcTokenLParen {
+			arg, err = p.parsePrimary()
+		} else {
+			arg, err = p.parsePower()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tok.text == "sqrt" && arg.Sign() >= 0 {
+			return newCalcFloat().Sqrt(arg), nil
+		}
+		x, _ := arg.Float64()
+		result := fn(x)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return nil, errCalcDomain
+		}
+		// float64 noise, sin(pi) should be 0 rather than 1.2e-16
+		if math.Abs(result) < 1e-15 {
+			result = 0
+		}
+		return newCalcFloat().SetFloat64(result), nil
+	}
+	return nil, errCalcSyntax
+}
+
+func calcPow(base, exponent *big.Float) (*big.Float, error) {
+	if exponent.IsInt() {
+		n, accuracy := exponent.Int64()
+		if accuracy == big.Exact && n >= -calcMaxExactPower && n <= calcMaxExactPower {
+			if n < 0 && base.Sign() == 0 {
+				return nil, errCalcDivByZero
+			}
+			result := newCalcFloat().SetInt64(1)
+			b := newCalcFloat().Set(base)
+			for e := abs64(n); e > 0; e >>= 1 {
+				if e&1 == 1 {
+					if result.Mul(result, b).IsInf() {
+						return nil, errCalcDomain
+					}
+				}
+				if e > 1 && b.Mul(b, b).IsInf() {
+					return nil, errCalcDomain
+				}
+			}
+			if n < 0 {
+				return calcFinite(newCalcFloat().Quo(newCalcFloat().SetInt64(1), result))
+			}
+			return result, nil
+		}
+	}
+
+	b, _ := base.Float64()
+	e, _ := exponent.Float64()
+	result := math.Pow(b, e)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, errCalcDomain
+	}
+	return newCalcFloat().SetFloat64(result), nil
+}
+
+func calcFactorial(value *big.Float) (*big.Float, error) {
+	if !value.IsInt() || value.Sign() < 0 {
+		return nil, errCalcDomain
+	}
+	n, _ := value.Int64()
+	if n > calcMaxFactorial {
+		return nil, errCalcDomain
+	}
+	result := new(big.Int).MulRange(1, n)
+	return newCalcFloat().SetInt(result), nil
+}
+
+func calcMod(left, right *big.Float) (*big.Float, error) {
+	if calcIsSmallInt(left) && calcIsSmallInt(right) {
+		l, _ := left.Int(nil)
+		r, _ := right.Int(nil)
+		return newCalcFloat().SetInt(new(big.Int).Rem(l, r)), nil
+	}
+	l, _ := left.Float64()
+	r, _ := right.Float64()
+	result := math.Mod(l, r)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, errCalcDomain
+	}
+	return newCalcFloat().SetFloat64(result), nil
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func evaluateExpression(expr string) (*big.Float, error) {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errCalcSyntax
+	}
+
+	p := &calcParser{tokens: tokens}
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(tokens) {
+		return nil, errCalcSyntax
+	}
+	return value, nil
+}
+
+func formatCalcResult(value *big.Float) string {
+	if calcIsSmallInt(value) {
+		i, _ := value.Int(nil)
+		if text := i.String(); len(strings.TrimPrefix(text, "-")) <= calcMaxExactIntDigits {
+			return text
+		}
+	}
+
+	text := value.Text('g', calcSignificantDigits)
+	if strings.ContainsAny(text, "e") {
+		return text
+	}
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
+
+var calcQueryPrefixes = []string{"what is", "what's", "calculate", "calc", "compute", "solve", "="}
+
+func trimCalcQuery(query string) string {
+	query = strings.TrimSpace(query)
+	lower := strings.ToLower(query)
+	for _, prefix := range calcQueryPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			query = strings.TrimSpace(query[len(prefix):])
+			break
+		}
+	}
+	return strings.TrimRight(query, "?= ")
+}
+
+// calcDashedDigitsPattern matches digit groups joined by single dashes, which
+// are dates, phone numbers or part numbers far more often than subtractions
+var calcDashedDigitsPattern = regexp.MustCompile(`^\d+(-\d+)+$`)
+
+// looksLikeMath filters out queries that would technically evaluate, such as
+// a lone number, a constant name or a date like "2024-01-15", but are not
+// calculations.
+func looksLikeMath(expr string) bool {
+	if calcDashedDigitsPattern.MatchString(strings.TrimSpace(expr)) {
+		return false
+	}
+	tokens, err := tokenizeExpression(expr)
+	if err != nil || len(tokens) < 2 {
+		return false
+	}
+	for _, tok := range tokens {
+		if tok.kind == calcTokenOp || tok.kind == calcTokenLParen {
+			return true
+		}
+		if _, ok := calcFunctions[tok.text]; ok && tok.kind == calcTokenIdent {
+			return true
+		}
+	}
+	return false
+}
+
+func buildCalculatorResult(expr string) (map[string]interface{}, error) {
+	value, err := evaluateExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type": SearchResultTypeCalculator,
+		"result": map[string]interface{}{
+			"query":  expr,
+			"result": formatCalcResult(value),
+		},
+	}, nil
+}
+
+// localSearchAnswer returns a calculator or unit converter result for queries
+// that can be answered offline, or nil when the query is a regular search.
+func localSearchAnswer(query string) map[string]interface{} {
+	query = trimCalcQuery(query)
+	if conversion, ok := parseUnitConversion(query); ok {
+		if result, err := buildUnitConverterResult(conversion); err == nil {
+			return result
+		}
+	}
+	if looksLikeMath(query) {
+		if result, err := buildCalculatorResult(query); err == nil {
+			return result
+		}
+	}
+	return nil
+}
+
+func Calculate(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := trimCalcQuery(r.URL.Query().Get("q"))
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	if conversion, ok := parseUnitConversion(query); ok {
+		result, err := buildUnitConverterResult(conversion)
+		if err != nil {
+			rw.writeError(StatusError, err.Error())
+			return
+		}
+		result["status"] = StatusSuccess
+		rw.write(result)
+		return
+	}
+
+	result, err := buildCalculatorResult(query)
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+	result["status"] = StatusSuccess
+	rw.write(result)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1+2*3", "7"},
+		{"2^10", "1024"},
+		{"2^-2", "0.25"},
+		{"10 % 3", "1"},
+		{"5!", "120"},
+		{"(1+2)(3+4)", "21"},
+		{"10^400 / 10^399", "10"},
+	}
+	for _, tt := range tests {
+		value, err := evaluateExpression(tt.expr)
+		if err != nil {
+			t.Errorf("evaluateExpression(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+		if got := formatCalcResult(value); got != tt.want {
+			t.Errorf("evaluateExpression(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateExpressionOverflow(t *testing.T) {
+	tests := []string{
+		"(10^100000)^100000",
+		"0*(10^100000)^100000",
+		"(10^100000)^100000-(10^100000)^100000",
+		"(10^100000)^100000/(10^100000)^100000",
+		"(10^100000)^100000 % 3.5",
+		"(10^100000)^5000/(10^-100000)^5000",
+		"(10^100000)^50000*(10^100000)^50000*(10^100000)^50000",
+		"(10^100000)^50000*10^100000^50000-(10^100000)^50000*10^100000^50000",
+		"sin((10^100000)^50000*(10^100000)^50000)",
+	}
+	for _, expr := range tests {
+		_, err := evaluateExpression(expr)
+		if !errors.Is(err, errCalcDomain) {
+			t.Errorf("evaluateExpression(%q) error = %v, want %v", expr, err, errCalcDomain)
+		}
+	}
+}
+
+func TestLocalSearchAnswerOverflow(t *testing.T) {
+	if answer := localSearchAnswer("0*(10^100000)^100000"); answer != nil {
+		t.Errorf("localSearchAnswer returned %v for an overflowing expression", answer)
+	}
+}
+
+func TestLocalSearchAnswerSkipsDashedNumbers(t *testing.T) {
+	for _, query := range []string{"2024-01-15", "555-123-4567"} {
+		if answer := localSearchAnswer(query); answer != nil {
+			t.Errorf("localSearchAnswer(%q) = %v, want nil", query, answer)
+		}
+	}
+	if answer := localSearchAnswer("2024 - 15"); answer == nil {
+		t.Error("localSearchAnswer(\"2024 - 15\") = nil, want a calculator result")
+	}
+}
+
+func TestConvertUnit(t *testing.T) {
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"5 mb to kb", 5000},
+		{"5 MB to KB", 5000},
+		{"1 gb to mb", 1000},
+		{"8 Mb to MB", 1},
+		{"1 kbit to bits", 1000},
+	}
+	for _, tt := range tests {
+		conversion, ok := parseUnitConversion(tt.query)
+		if !ok {
+			t.Errorf("parseUnitConversion(%q) failed", tt.query)
+			continue
+		}
+		got, err := convertUnit(conversion)
+		if err != nil {
+			t.Errorf("convertUnit(%q) returned error: %v", tt.query, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9*tt.want {
+			t.Errorf("convertUnit(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestConvertUnitOverflow(t *testing.T) {
+	conversion, ok := parseUnitConversion("1e308 ly to nm")
+	if !ok {
+		t.Fatal("parseUnitConversion(\"1e308 ly to nm\") failed")
+	}
+	if _, err := convertUnit(conversion); !errors.Is(err, errCalcDomain) {
+		t.Errorf("convertUnit error = %v, want %v", err, errCalcDomain)
+	}
+	if answer := localSearchAnswer("1e308 ly to nm"); answer != nil {
+		t.Errorf("localSearchAnswer returned %v for an overflowing conversion", answer)
+	}
+}
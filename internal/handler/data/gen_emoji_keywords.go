@@ -0,0 +1,98 @@
+//go:build ignore
+
+// gen_emoji_keywords merges the cldr keyword annotations into the keywords
+// column of emoji.tsv. pass it the annotations xml files of a cldr release,
+// annotations/en.xml for the base emoji and annotationsDerived/en.xml for
+// skin tones and other sequences:
+//
+//	go run gen_emoji_keywords.go emoji.tsv cldr/common/annotations/en.xml cldr/common/annotationsDerived/en.xml
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type annotationFile struct {
+	Annotations []struct {
+		CP   string `xml:"cp,attr"`
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"annotations>annotation"`
+}
+
+// cldr keys its annotations without the emoji variation selector
+func annotationKey(emoji string) string {
+	return strings.ReplaceAll(emoji, "\ufe0f", "")
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		log.Fatal("usage: gen_emoji_keywords emoji.tsv annotations.xml...")
+	}
+
+	keywords := map[string][]string{}
+	for _, path := range os.Args[2:] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var file annotationFile
+		if err := xml.Unmarshal(data, &file); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		for _, a := range file.Annotations {
+			// the tts annotation is the short name, which is already a column
+			if a.Type == "tts" {
+				continue
+			}
+			for _, keyword := range strings.Split(a.Text, "|") {
+				if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+					keywords[annotationKey(a.CP)] = append(keywords[annotationKey(a.CP)], keyword)
+				}
+			}
+		}
+	}
+
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		for len(fields) < 7 {
+			fields = append(fields, "")
+		}
+
+		var merged []string
+		seen := map[string]bool{strings.ToLower(fields[4]): true}
+		if fields[6] != "" {
+			merged = strings.Split(fields[6], ",")
+		}
+		for _, keyword := range merged {
+			seen[keyword] = true
+		}
+		for _, keyword := range keywords[annotationKey(fields[0])] {
+			// commas separate the keywords in the tsv
+			keyword = strings.ReplaceAll(keyword, ",", "")
+			if !seen[keyword] {
+				seen[keyword] = true
+				merged = append(merged, keyword)
+			}
+		}
+		fields[6] = strings.Join(merged, ",")
+		lines[i] = strings.Join(fields, "\t")
+	}
+
+	if err := os.WriteFile(os.Args[1], []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("updated", os.Args[1])
+}
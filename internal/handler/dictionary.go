@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const wiktionaryBaseURL = "https://en.wiktionary.org/api/rest_v1/page"
+
+// wikimedia asks api clients to identify themselves
+var wikimediaHeaders = map[string]string{
+	"User-Agent": "MeteorDiscordBot/1.0 (https://github.com/meteor-discord/backend)",
+}
+
+type dictionaryPronunciation struct {
+	IPA   string `json:"ipa,omitempty"`
+	Audio string `json:"audio,omitempty"`
+}
+
+type dictionaryDefinition struct {
+	Definition string   `json:"definition"`
+	Examples   []string `json:"examples"`
+}
+
+type dictionaryMeaning struct {
+	PartOfSpeech string                 `json:"part_of_speech"`
+	Definitions  []dictionaryDefinition `json:"definitions"`
+}
+
+type dictionaryResult struct {
+	Word           string                    `json:"word"`
+	Language       string                    `json:"language"`
+	Source         string                    `json:"source"`
+	URL            string                    `json:"url"`
+	Pronunciations []dictionaryPronunciation `json:"pronunciations"`
+	Etymology      string                    `json:"etymology,omitempty"`
+	Meanings       []dictionaryMeaning       `json:"meanings"`
+}
+
+type wiktionaryDefinition struct {
+	Definition     string   `json:"definition"`
+	Examples       []string `json:"examples"`
+	ParsedExamples []struct {
+		Example string `json:"example"`
+	} `json:"parsedExamples"`
+}
+
+type wiktionaryUsage struct {
+	PartOfSpeech string                 `json:"partOfSpeech"`
+	Language     string                 `json:"language"`
+	Definitions  []wiktionaryDefinition `json:"definitions"`
+}
+
+// cleanWiktionaryHTML turns the html fragments returned by the definition
+// api into plain text.
+func cleanWiktionaryHTML(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(stripHTML(s))), " ")
+}
+
+func fetchWiktionary(word, lang string) (*dictionaryResult, error) {
+	escaped := url.PathEscape(strings.ReplaceAll(word, " ", "_"))
+
+	var usages map[string][]wiktionaryUsage
+	if err := fetchJSONWithHeaders(fmt.Sprintf("%s/definition/%s?redirect=true", wiktionaryBaseURL, escaped), wikimediaHeaders, &usages); err != nil {
+		if isNotFoundError(err) {
+			return nil, errWordNotFound
+		}
+		return nil, err
+	}
+
+	entries := usages[lang]
+	if len(entries) == 0 {
+		return nil, errWordNotFound
+	}
+
+	result := &dictionaryResult{
+		Word:           word,
+		Language:       entries[0].Language,
+		Source:         "wiktionary",
+		URL:            fmt.Sprintf("https://en.wiktionary.org/wiki/%s#%s", escaped, strings.ReplaceAll(entries[0].Language, " ", "_")),
+		Pronunciations: []dictionaryPronunciation{},
+	}
+
+	for _, usage := range entries {
+		meaning := dictionaryMeaning{PartOfSpeech: strings.ToLower(usage.PartOfSpeech)}
+		for _, d := range usage.Definitions {
+			definition := cleanWiktionaryHTML(d.Definition)
+			if definition == "" {
+				continue
+			}
+
+			examples := []string{}
+			for _, e := range d.ParsedExamples {
+				examples = append(examples, cleanWiktionaryHTML(e.Example))
+			}
+			if len(d.ParsedExamples) == 0 {
+				for _, e := range d.Examples {
+					examples = append(examples, cleanWiktionaryHTML(e))
+				}
+			}
+
+			meaning.Definitions = append(meaning.Definitions, dictionaryDefinition{
+				Definition: definition,
+				Examples:   examples,
+			})
+		}
+		if len(meaning.Definitions) > 0 {
+			result.Meanings = append(result.Meanings, meaning)
+		}
+	}
+
+	if len(result.Meanings) == 0 {
+		return nil, errWordNotFound
+	}
+
+	// pronunciation and etymology are only part of the rendered page, a
+	// failure here still leaves a useful result
+	if body, err := fetchBytesWithHeaders(fmt.Sprintf("%s/html/%s?redirect=true", wiktionaryBaseURL, escaped), wikimediaHeaders); err == nil {
+		if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+			addWiktionaryPageDetails(doc, result)
+		}
+	}
+
+	return result, nil
+}
+
+// addWiktionaryPageDetails reads the parsoid html of the page, where every
+// heading opens a <section>, so the language's section contains its
+// pronunciation and etymology subsections.
+func addWiktionaryPageDetails(doc *goquery.Document, result *dictionaryResult) {
+	heading := doc.Find("h2").FilterFunction(func(i int, s *goquery.Selection) bool {
+		return strings.TrimSpace(s.Text()) == result.Language
+	}).First()
+	if heading.Length() == 0 {
+		return
+	}
+	section := heading.Parent()
+
+	seen := map[string]bool{}
+	section.Find("span.IPA").Each(func(i int, s *goquery.Selection) {
+		ipa := strings.TrimSpace(s.Text())
+		if ipa == "" || seen[ipa] || len(result.Pronunciations) >= 5 {
+			return
+		}
+		seen[ipa] = true
+		result.Pronunciations = append(result.Pronunciations, dictionaryPronunciation{IPA: ipa})
+	})
+
+	section.Find("audio").Each(func(i int, s *goquery.Selection) {
+		src, ok := s.Find("source").First().Attr("src")
+		if !ok || src == "" {
+			return
+		}
+		if strings.HasPrefix(src, "//") {
+			src = "https:" + src
+		}
+		if len(result.Pronunciations) > 0 && result.Pronunciations[0].Audio == "" {
+			result.Pronunciations[0].Audio = src
+			return
+		}
+		result.Pronunciations = append(result.Pronunciations, dictionaryPronunciation{Audio: src})
+	})
+
+	section.Find("h3, h4").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if !strings.HasPrefix(strings.TrimSpace(s.Text()), "Etymology") {
+			return true
+		}
+		etymology := strings.TrimSpace(s.Parent().Find("p").First().Text())
+		if etymology != "" {
+			result.Etymology = strings.Join(strings.Fields(etymology), " ")
+			return false
+		}
+		return true
+	})
+}
+
+func dictionaryAPIResult(word string) (*dictionaryResult, error) {
+	entries, err := fetchDictionaryAPI(word)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errWordNotFound
+	}
+
+	result := &dictionaryResult{
+		Word:           entries[0].Word,
+		Language:       "English",
+		Source:         "dictionaryapi",
+		URL:            fmt.Sprintf("https://en.wiktionary.org/wiki/%s", url.PathEscape(word)),
+		Pronunciations: []dictionaryPronunciation{},
+	}
+
+	for _, entry := range entries {
+		if result.Etymology == "" {
+			result.Etymology = entry.Origin
+		}
+		for _, p := range entry.Phonetics {
+			if p.Text == "" && p.Audio == "" {
+				continue
+			}
+			result.Pronunciations = append(result.Pronunciations, dictionaryPronunciation{IPA: p.Text, Audio: p.Audio})
+		}
+		for _, m := range entry.Meanings {
+			meaning := dictionaryMeaning{PartOfSpeech: m.PartOfSpeech}
+			for _, d := range m.Definitions {
+				examples := []string{}
+				if d.Example != "" {
+					examples = append(examples, d.Example)
+				}
+				meaning.Definitions = append(meaning.Definitions, dictionaryDefinition{
+					Definition: d.Definition,
+					Examples:   examples,
+				})
+			}
+			result.Meanings = append(result.Meanings, meaning)
+		}
+	}
+
+	return result, nil
+}
+
+func GetDictionaryV1(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	word := strings.TrimSpace(r.URL.Query().Get("word"))
+	if word == "" {
+		rw.writeError(StatusError, "missing 'word' query parameter")
+		return
+	}
+
+	lang := strings.ToLower(r.URL.Query().Get("lang"))
+	if lang == "" {
+		lang = "en"
+	}
+
+	result, err := fetchWiktionary(word, lang)
+	if err != nil && lang == "en" {
+		result, err = dictionaryAPIResult(word)
+	}
+
+	if errors.Is(err, errWordNotFound) {
+		rw.writeError(StatusNotFound, "word not found")
+		return
+	}
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch dictionary entry")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status": StatusSuccess,
+		"result": result,
+	})
+}
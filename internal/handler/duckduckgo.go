@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -49,48 +50,22 @@ func getDDGHeaders() map[string]string {
 }
 
 func fetchDDGHTML(targetURL string) (*goquery.Document, error) {
-	req, err := http.NewRequest("GET", targetURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	for k, v := range getDDGHeaders() {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := ddgClient.Do(req)
+	resp, err := fetchResponse(context.Background(), ddgClient, targetURL, getDDGHeaders())
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
-	}
-
 	return goquery.NewDocumentFromReader(resp.Body)
 }
 
 func fetchDDGRaw(targetURL string) ([]byte, error) {
-	req, err := http.NewRequest("GET", targetURL, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	for k, v := range getDDGHeaders() {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := ddgClient.Do(req)
+	resp, err := fetchResponse(context.Background(), ddgClient, targetURL, getDDGHeaders())
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
-	}
-
 	return io.ReadAll(resp.Body)
 }
 
@@ -122,58 +97,63 @@ func SearchDuckDuckGo(w http.ResponseWriter, r *http.Request) {
 		searchURL += "&kp=-2"
 	}
 
+	var results []map[string]interface{}
+	if answer := localSearchAnswer(query); answer != nil {
+		results = append(results, answer)
+	}
+
 	doc, err := fetchDDGHTML(searchURL)
-	if err != nil {
+	if err != nil && len(results) == 0 {
 		writeSearchJSONError(w, StatusError, "failed to fetch search results")
 		return
 	}
 
-	var results []map[string]interface{}
-
-	doc.Find("div.result, div.results_links").Each(func(i int, s *goquery.Selection) {
-		if len(results) >= 20 {
-			return
-		}
+	if doc != nil {
+		doc.Find("div.result, div.results_links").Each(func(i int, s *goquery.Selection) {
+			if len(results) >= 20 {
+				return
+			}
 
-		link := s.Find("a.result__a").First()
-		href, exists := link.Attr("href")
-		if !exists || href == "" {
-			return
-		}
+			link := s.Find("a.result__a").First()
+			href, exists := link.Attr("href")
+			if !exists || href == "" {
+				return
+			}
 
-		if strings.Contains(href, "duckduckgo.com/l/") {
-			if u, err := url.Parse(href); err == nil {
-				if uddg := u.Query().Get("uddg"); uddg != "" {
-					href = uddg
+			if strings.Contains(href, "duckduckgo.com/l/") {
+				if u, err := url.Parse(href); err == nil {
+					if uddg := u.Query().Get("uddg"); uddg != "" {
+						href = uddg
+					}
 				}
 			}
-		}
 
-		title := strings.TrimSpace(link.Text())
-		if title == "" {
-			return
-		}
+			title := strings.TrimSpace(link.Text())
+			if title == "" {
+				return
+			}
 
-		displayLink := s.Find("a.result__url").First().Text()
-		displayLink = strings.TrimSpace(displayLink)
-		if displayLink == "" {
-			if parsedURL, err := url.Parse(href); err == nil {
-				displayLink = parsedURL.Host
+			displayLink := s.Find("a.result__url").First().Text()
+			displayLink = strings.TrimSpace(displayLink)
+			if displayLink == "" {
+				if parsedURL, err := url.Parse(href); err == nil {
+					displayLink = parsedURL.Host
+				}
 			}
-		}
 
-		snippet := strings.TrimSpace(s.Find("a.result__snippet").First().Text())
+			snippet := strings.TrimSpace(s.Find("a.result__snippet").First().Text())
 
-		results = append(results, map[string]interface{}{
-			"type": SearchResultTypeSearchResult,
-			"result": map[string]interface{}{
-				"url":          href,
-				"title":        title,
-				"display_link": displayLink,
-				"snippet":      snippet,
-			},
+			results = append(results, map[string]interface{}{
+				"type": SearchResultTypeSearchResult,
+				"result": map[string]interface{}{
+					"url":          href,
+					"title":        title,
+					"display_link": displayLink,
+					"snippet":      snippet,
+				},
+			})
 		})
-	})
+	}
 
 	if len(results) == 0 {
 		writeSearchJSONError(w, StatusNotFound, "no results found")
@@ -341,6 +321,8 @@ func SearchMaps(w http.ResponseWriter, r *http.Request) {
 
 	var locations []struct {
 		PlaceID     int    `json:"place_id"`
+		OsmType     string `json:"osm_type"`
+		OsmID       int64  `json:"osm_id"`
 		Lat         string `json:"lat"`
 		Lon         string `json:"lon"`
 		DisplayName string `json:"display_name"`
@@ -369,10 +351,7 @@ func SearchMaps(w http.ResponseWriter, r *http.Request) {
 
 	loc := locations[0]
 
-	mapURL := fmt.Sprintf(
-		"https://staticmap.openstreetmap.de/staticmap.php?center=%s,%s&zoom=14&size=800x400&maptype=mapnik&markers=%s,%s,red-pushpin",
-		loc.Lat, loc.Lon, loc.Lat, loc.Lon,
-	)
+	mapURL := mapkitURL(loc.Lat, loc.Lon, 14)
 
 	city := loc.Address.City
 	if city == "" {
@@ -395,6 +374,8 @@ func SearchMaps(w http.ResponseWriter, r *http.Request) {
 			"lat": loc.Lat,
 			"lon": loc.Lon,
 		},
+		"place_id":     loc.PlaceID,
+		"osm_id":       osmID(loc.OsmType, loc.OsmID),
 		"url":          fmt.Sprintf("https://www.openstreetmap.org/?mlat=%s&mlon=%s#map=15/%s/%s", loc.Lat, loc.Lon, loc.Lat, loc.Lon),
 		"display_type": loc.Type,
 		"style": map[string]interface{}{
@@ -418,11 +399,13 @@ func SearchMaps(w http.ResponseWriter, r *http.Request) {
 
 			places = append(places, map[string]interface{}{
 				"place": map[string]interface{}{
-					"name":    l.DisplayName,
-					"address": l.DisplayName,
-					"city":    lCity,
-					"lat":     l.Lat,
-					"lon":     l.Lon,
+					"name":     l.DisplayName,
+					"address":  l.DisplayName,
+					"city":     lCity,
+					"place_id": l.PlaceID,
+					"osm_id":   osmID(l.OsmType, l.OsmID),
+					"lat":      l.Lat,
+					"lon":      l.Lon,
 				},
 			})
 		}
@@ -442,94 +425,3 @@ func SearchMaps(w http.ResponseWriter, r *http.Request) {
 
 	writeSearchJSON(w, response)
 }
-
-func SearchMapsSupplemental(w http.ResponseWriter, r *http.Request) {
-	writeSearchJSON(w, map[string]interface{}{
-		"status":  StatusSuccess,
-		"message": "supplemental data not available",
-	})
-}
-
-func SearchNews(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		query = "top stories"
-	}
-
-	combinedQuery := query + " news"
-	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s&kl=us-en", url.QueryEscape(combinedQuery))
-
-	doc, err := fetchDDGHTML(searchURL)
-	if err != nil {
-		writeSearchJSONError(w, StatusError, "failed to fetch news results")
-		return
-	}
-
-	var cards []map[string]interface{}
-
-	doc.Find("div.result, div.results_links").Each(func(i int, s *goquery.Selection) {
-		if len(cards) >= 15 {
-			return
-		}
-
-		link := s.Find("a.result__a").First()
-		href, exists := link.Attr("href")
-		if !exists || href == "" {
-			return
-		}
-
-		if strings.Contains(href, "duckduckgo.com/l/") {
-			if u, err := url.Parse(href); err == nil {
-				if uddg := u.Query().Get("uddg"); uddg != "" {
-					href = uddg
-				}
-			}
-		}
-
-		title := strings.TrimSpace(link.Text())
-		if title == "" {
-			return
-		}
-
-		snippet := strings.TrimSpace(s.Find("a.result__snippet").First().Text())
-
-		displayURL := strings.TrimSpace(s.Find("a.result__url").First().Text())
-
-		publisher := "News"
-		if displayURL != "" {
-			if u, err := url.Parse("https://" + displayURL); err == nil {
-				publisher = u.Host
-			} else {
-				publisher = displayURL
-			}
-		}
-
-		cards = append(cards, map[string]interface{}{
-			"type":  NewsCardTypeArticle,
-			"title": title,
-			"url":   href,
-			"publisher": map[string]interface{}{
-				"name": publisher,
-				"icon": fmt.Sprintf("https://www.google.com/s2/favicons?domain=%s&sz=64", publisher),
-			},
-			"description": snippet,
-		})
-	})
-
-	if len(cards) == 0 {
-		writeSearchJSONError(w, StatusNotFound, "no news results found")
-		return
-	}
-
-	writeSearchJSON(w, map[string]interface{}{
-		"status": StatusSuccess,
-		"cards":  cards,
-	})
-}
-
-func SearchNewsSupplemental(w http.ResponseWriter, r *http.Request) {
-	writeSearchJSON(w, map[string]interface{}{
-		"status":  StatusSuccess,
-		"message": "supplemental data not available",
-	})
-}
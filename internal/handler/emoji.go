@@ -0,0 +1,410 @@
+package handler
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emoji.tsv is generated from the unicode emoji-test.txt (which carries the
+// cldr short names, groups and versions) joined with github's shortcodes. its
+// last column holds extra search keywords, data/gen_emoji_keywords.go merges
+// the cldr keyword annotations into it.
+//
+//go:embed data/emoji.tsv
+var emojiData string
+
+const (
+	emojiSearchDefaultLimit = 25
+	emojiSearchMaxLimit     = 100
+
+	zeroWidthJoiner   = '\u200d'
+	variationSelector = '\ufe0f'
+)
+
+type emojiEntry struct {
+	Emoji      string
+	Name       string
+	Group      string
+	Subgroup   string
+	Version    string
+	Shortcodes []string
+	// Variants holds the skin tone versions of this emoji
+	Variants []*emojiEntry
+
+	keywords  []string
+	isVariant bool
+}
+
+var (
+	emojiOnce    sync.Once
+	emojiList    []*emojiEntry
+	emojiByChar  map[string]*emojiEntry
+	emojiByName  map[string]*emojiEntry
+	emojiByShort map[string]*emojiEntry
+)
+
+var emojiWordSplitter = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func emojiWords(s string) []string {
+	return emojiWordSplitter.Split(strings.ToLower(s), -1)
+}
+
+func loadEmojis() {
+	emojiOnce.Do(func() {
+		emojiByChar = make(map[string]*emojiEntry)
+		emojiByName = make(map[string]*emojiEntry)
+		emojiByShort = make(map[string]*emojiEntry)
+
+		for _, line := range strings.Split(emojiData, "\n") {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.Split(line, "\t")
+			if len(fields) < 6 {
+				continue
+			}
+
+			e := &emojiEntry{
+				Emoji:    fields[0],
+				Group:    fields[1],
+				Subgroup: fields[2],
+				Version:  fields[3],
+				Name:     fields[4],
+			}
+			if fields[5] != "" {
+				e.Shortcodes = strings.Split(fields[5], ",")
+			}
+			var annotations []string
+			if len(fields) > 6 && fields[6] != "" {
+				annotations = strings.Split(fields[6], ",")
+			}
+
+			// skin tone variants are listed right after their base emoji
+			// and share its name up to the colon
+			if base, tone, ok := strings.Cut(e.Name, ": "); ok && strings.Contains(tone, "skin tone") {
+				if parent, exists := emojiByName[strings.ToLower(base)]; exists {
+					e.isVariant = true
+					parent.Variants = append(parent.Variants, e)
+				}
+			}
+
+			seen := map[string]bool{}
+			sources := append([]string{e.Name, e.Subgroup, e.Group}, e.Shortcodes...)
+			for _, source := range append(sources, annotations...) {
+				for _, word := range emojiWords(source) {
+					if word != "" && !seen[word] {
+						seen[word] = true
+						e.keywords = append(e.keywords, word)
+					}
+				}
+			}
+
+			emojiList = append(emojiList, e)
+			emojiByChar[e.Emoji] = e
+			emojiByChar[strings.ReplaceAll(e.Emoji, string(variationSelector), "")] = e
+			// names are matched case insensitively, "OK hand" or "flag: Japan"
+			name := strings.ToLower(e.Name)
+			if _, exists := emojiByName[name]; !exists {
+				emojiByName[name] = e
+			}
+			for _, code := range e.Shortcodes {
+				emojiByShort[code] = e
+			}
+		}
+	})
+}
+
+func emojiCodepoints(emoji string) []string {
+	var codepoints []string
+	for _, r := range emoji {
+		codepoints = append(codepoints, fmt.Sprintf("U+%04X", r))
+	}
+	return codepoints
+}
+
+func emojiHexSequence(emoji, separator string, keepVariationSelector bool) string {
+	var parts []string
+	for _, r := range emoji {
+		if r == variationSelector && !keepVariationSelector {
+			continue
+		}
+		parts = append(parts, strconv.FormatInt(int64(r), 16))
+	}
+	return strings.Join(parts, separator)
+}
+
+func emojiSlug(name string) string {
+	return strings.Trim(strings.Join(emojiWords(name), "-"), "-")
+}
+
+// emojiImages returns vendor artwork urls. Each set names its files
+// differently, twemoji only keeps the variation selector inside zwj
+// sequences, noto drops it entirely and apple keeps the fully qualified
+// sequence.
+func emojiImages(emoji string) map[string]string {
+	isZWJ := strings.ContainsRune(emoji, zeroWidthJoiner)
+	return map[string]string{
+		"twemoji": fmt.Sprintf("https://cdn.jsdelivr.net/gh/jdecked/twemoji@latest/assets/72x72/%s.png", emojiHexSequence(emoji, "-", isZWJ)),
+		"noto":    fmt.Sprintf("https://cdn.jsdelivr.net/gh/googlefonts/noto-emoji@main/png/128/emoji_u%s.png", emojiHexSequence(emoji, "_", false)),
+		"apple":   fmt.Sprintf("https://cdn.jsdelivr.net/npm/emoji-datasource-apple/img/apple/64/%s.png", emojiHexSequence(emoji, "-", true)),
+	}
+}
+
+func buildEmojiSummary(e *emojiEntry) map[string]interface{} {
+	shortcodes := make([]string, 0, len(e.Shortcodes))
+	for _, code := range e.Shortcodes {
+		shortcodes = append(shortcodes, ":"+code+":")
+	}
+	return map[string]interface{}{
+		"emoji":      e.Emoji,
+		"name":       e.Name,
+		"shortcodes": shortcodes,
+		"category":   e.Group,
+		"subgroup":   e.Subgroup,
+	}
+}
+
+func buildEmojiDetails(e *emojiEntry) map[string]interface{} {
+	details := buildEmojiSummary(e)
+	slug := emojiSlug(e.Name)
+	details["slug"] = slug
+	details["url"] = "https://emojipedia.org/" + slug
+	details["codepoints"] = emojiCodepoints(e.Emoji)
+	details["version"] = e.Version
+	details["zwj"] = strings.ContainsRune(e.Emoji, zeroWidthJoiner)
+	details["images"] = emojiImages(e.Emoji)
+	details["keywords"] = e.keywords
+
+	variants := make([]map[string]interface{}, 0, len(e.Variants))
+	for _, v := range e.Variants {
+		variants = append(variants, map[string]interface{}{
+			"emoji":      v.Emoji,
+			"name":       v.Name,
+			"codepoints": emojiCodepoints(v.Emoji),
+			"images":     emojiImages(v.Emoji),
+		})
+	}
+	details["skin_tones"] = variants
+
+	return details
+}
+
+// editDistanceWithin reports whether a and b are at most maxEdits apart,
+// counting a swap of two adjacent letters as a single edit.
+func editDistanceWithin(a, b string, maxEdits int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if abs64(int64(len(ra)-len(rb))) > int64(maxEdits) {
+		return false
+	}
+
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)] <= maxEdits
+}
+
+// scoreEmoji ranks an emoji against the query terms. Every term has to match
+// something, exact name and shortcode hits rank above keyword and fuzzy hits.
+func scoreEmoji(e *emojiEntry, query string, terms []string) int {
+	score := 0
+	lowerName := strings.ToLower(e.Name)
+	if lowerName == query {
+		score += 1000
+	} else if strings.HasPrefix(lowerName, query) {
+		score += 200
+	}
+	for _, code := range e.Shortcodes {
+		if code == strings.ReplaceAll(query, " ", "_") {
+			score += 500
+		}
+	}
+
+	nameWords := emojiWords(e.Name)
+	for _, term := range terms {
+		best := 0
+		for _, word := range nameWords {
+			switch {
+			case word == term:
+				best = max(best, 50)
+			case strings.HasPrefix(word, term):
+				best = max(best, 30)
+			}
+		}
+		for _, keyword := range e.keywords {
+			switch {
+			case keyword == term:
+				best = max(best, 20)
+			case strings.HasPrefix(keyword, term):
+				best = max(best, 10)
+			case len(term) >= 4 && editDistanceWithin(keyword, term, 1):
+				best = max(best, 5)
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+
+	// prefer older, simpler emoji over long zwj sequences on ties, the
+	// variation selector of "❤️" doesn't make it any less simple
+	score -= len([]rune(strings.ReplaceAll(e.Emoji, string(variationSelector), "")))
+	return score
+}
+
+func searchEmojis(query string, limit int) []*emojiEntry {
+	loadEmojis()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var terms []string
+	for _, word := range emojiWords(query) {
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+
+	type scored struct {
+		entry *emojiEntry
+		score int
+	}
+	var matches []scored
+	for _, e := range emojiList {
+		if e.isVariant {
+			continue
+		}
+		if score := scoreEmoji(e, query, terms); score > 0 {
+			matches = append(matches, scored{e, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := make([]*emojiEntry, 0, min(limit, len(matches)))
+	for i := 0; i < len(matches) && i < limit; i++ {
+		results = append(results, matches[i].entry)
+	}
+	return results
+}
+
+// lookupEmoji finds an emoji by the character itself, a :shortcode: or its
+// exact name.
+func lookupEmoji(query string) *emojiEntry {
+	loadEmojis()
+
+	query = strings.TrimSpace(query)
+	if e, ok := emojiByChar[query]; ok {
+		return e
+	}
+	if e, ok := emojiByChar[strings.ReplaceAll(query, string(variationSelector), "")]; ok {
+		return e
+	}
+	if e, ok := emojiByShort[strings.Trim(strings.ToLower(query), ":")]; ok {
+		return e
+	}
+	if e, ok := emojiByName[strings.ToLower(query)]; ok {
+		return e
+	}
+	return nil
+}
+
+func SearchEmoji(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	limit := emojiSearchDefaultLimit
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, emojiSearchMaxLimit)
+	}
+
+	var entries []*emojiEntry
+	if e := lookupEmoji(query); e != nil {
+		entries = append(entries, e)
+	}
+	for _, e := range searchEmojis(query, limit) {
+		if len(entries) >= limit {
+			break
+		}
+		if len(entries) > 0 && entries[0] == e {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		rw.writeError(StatusNotFound, "no emoji found")
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		results = append(results, buildEmojiSummary(e))
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"results": results,
+	})
+}
+
+func GetEmojipedia(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("emoji")
+	if query == "" {
+		query = r.URL.Query().Get("q")
+	}
+	if query == "" {
+		rw.writeError(StatusError, "missing 'emoji' query parameter")
+		return
+	}
+
+	e := lookupEmoji(query)
+	if e == nil {
+		if matches := searchEmojis(query, 1); len(matches) > 0 {
+			e = matches[0]
+		}
+	}
+	if e == nil {
+		rw.writeError(StatusNotFound, "emoji not found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status": StatusSuccess,
+		"data":   buildEmojiDetails(e),
+	})
+}
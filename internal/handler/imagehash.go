@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// imageHashes holds the 64-bit perceptual hashes of an image. Two images are
+// considered similar when the hamming distance between their hashes is small.
+type imageHashes struct {
+	Average    uint64
+	Difference uint64
+	Perceptual uint64
+}
+
+func (h imageHashes) hex() map[string]string {
+	return map[string]string{
+		"ahash": fmt.Sprintf("%016x", h.Average),
+		"dhash": fmt.Sprintf("%016x", h.Difference),
+		"phash": fmt.Sprintf("%016x", h.Perceptual),
+	}
+}
+
+func parseImageHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+func hashSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// grayscaleMatrix downsamples img to a w*h matrix of luminance values by
+// averaging every source pixel that falls into each target cell.
+func grayscaleMatrix(img image.Image, w, h int) [][]float64 {
+	bounds := img.Bounds()
+	sums := make([][]float64, h)
+	counts := make([][]int, h)
+	for y := range sums {
+		sums[y] = make([]float64, w)
+		counts[y] = make([]int, w)
+	}
+
+	bw, bh := bounds.Dx(), bounds.Dy()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ty := (y - bounds.Min.Y) * h / bh
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			tx := (x - bounds.Min.X) * w / bw
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[ty][tx] += 0.299*float64(r>>8) + 0.587*float64(g>>8) + 0.114*float64(b>>8)
+			counts[ty][tx]++
+		}
+	}
+
+	for y := range sums {
+		for x := range sums[y] {
+			if counts[y][x] > 0 {
+				sums[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+	return sums
+}
+
+func averageHash(img image.Image) uint64 {
+	m := grayscaleMatrix(img, 8, 8)
+
+	var total float64
+	for _, row := range m {
+		for _, v := range row {
+			total += v
+		}
+	}
+	mean := total / 64
+
+	var hash uint64
+	for _, row := range m {
+		for _, v := range row {
+			hash <<= 1
+			if v > mean {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func differenceHash(img image.Image) uint64 {
+	m := grayscaleMatrix(img, 9, 8)
+
+	var hash uint64
+	for _, row := range m {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if row[x] < row[x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func perceptualHash(img image.Image) uint64 {
+	const size = 32
+	m := grayscaleMatrix(img, size, size)
+
+	// only the top-left 8x8 block of the dct is needed, it holds the lowest
+	// frequencies which survive resizing and recompression
+	var coeffs [64]float64
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					sum += m[y][x] *
+						math.Cos(float64(2*y+1)*float64(u)*math.Pi/(2*size)) *
+						math.Cos(float64(2*x+1)*float64(v)*math.Pi/(2*size))
+				}
+			}
+			coeffs[u*8+v] = sum
+		}
+	}
+
+	// the dc coefficient is excluded from the median as it only encodes
+	// overall brightness
+	sorted := make([]float64, 63)
+	copy(sorted, coeffs[1:])
+	sort.Float64s(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var hash uint64
+	for _, c := range coeffs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+func computeImageHashes(img image.Image) imageHashes {
+	return imageHashes{
+		Average:    averageHash(img),
+		Difference: differenceHash(img),
+		Perceptual: perceptualHash(img),
+	}
+}
@@ -0,0 +1,419 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const llmTimeout = 90 * time.Second
+
+var (
+	errLLMNotConfigured = errors.New("llm endpoint not configured")
+	errLLMBlocked       = errors.New("blocked by content filter")
+)
+
+var llmClient = &http.Client{
+	Timeout: 2 * time.Minute,
+}
+
+// llmPreset describes how one route talks to a model. Every field can be
+// overridden per preset with LLM_<NAME>_* environment variables, falling back
+// to the global LLM_* ones.
+type llmPreset struct {
+	Name string
+	// BaseURL is set for presets whose model is only served by its own
+	// provider. The global LLM_BASE_URL, LLM_API_KEY and LLM_MODEL don't
+	// apply to those, only their LLM_<NAME>_* overrides do.
+	BaseURL      string
+	Model        string
+	SystemPrompt string
+	// MaxTokens caps the completion length, requests may only ask for less
+	MaxTokens      int
+	MaxPromptChars int
+	Temperature    float64
+}
+
+var llmPresets = map[string]llmPreset{
+	"gpt": {
+		Name:           "gpt",
+		Model:          "gpt-4o-mini",
+		SystemPrompt:   "You are a helpful assistant in a Discord chat. Keep answers concise and use Discord markdown.",
+		MaxTokens:      1024,
+		MaxPromptChars: 4000,
+		Temperature:    0.7,
+	},
+	"grok": {
+		Name:           "grok",
+		BaseURL:        "https://api.x.ai/v1",
+		Model:          "grok-3-mini",
+		SystemPrompt:   "You are Grok, a witty assistant in a Discord chat. Answer directly, a bit of humor is welcome. Use Discord markdown.",
+		MaxTokens:      1024,
+		MaxPromptChars: 4000,
+		Temperature:    0.9,
+	},
+	"bard": {
+		Name:           "bard",
+		BaseURL:        "https://generativelanguage.googleapis.com/v1beta/openai",
+		Model:          "gemini-2.0-flash",
+		SystemPrompt:   "You are Bard, a helpful assistant in a Discord chat. Use Discord markdown and keep answers reasonably short.",
+		MaxTokens:      2048,
+		MaxPromptChars: 8000,
+		Temperature:    0.7,
+	},
+	"gemini": {
+		Name:           "gemini",
+		BaseURL:        "https://generativelanguage.googleapis.com/v1beta/openai",
+		Model:          "gemini-2.0-flash",
+		SystemPrompt:   "You are Gemini, a helpful assistant in a Discord chat. Use Discord markdown.",
+		MaxTokens:      2048,
+		MaxPromptChars: 8000,
+		Temperature:    0.7,
+	},
+	"text-generator": {
+		Name:           "text-generator",
+		Model:          "gpt-4o-mini",
+		SystemPrompt:   "Continue the text given by the user. Reply with the continuation only, do not repeat the given text or comment on it.",
+		MaxTokens:      256,
+		MaxPromptChars: 2000,
+		Temperature:    1.0,
+	},
+	"inferkit": {
+		Name:           "inferkit",
+		Model:          "gpt-4o-mini",
+		SystemPrompt:   "Continue the text given by the user in the same style and voice. Reply with the continuation only, do not repeat the given text or comment on it.",
+		MaxTokens:      400,
+		MaxPromptChars: 3000,
+		Temperature:    0.9,
+	},
+}
+
+// llmEndpoint is an OpenAI compatible chat completions api. Anything that
+// serves /chat/completions works, including llama.cpp's server and ollama's
+// /v1 endpoint.
+type llmEndpoint struct {
+	baseURL string
+	apiKey  string
+}
+
+// llmPresetEnv reads LLM_<PRESET>_<key>.
+func llmPresetEnv(preset, key string) string {
+	return os.Getenv("LLM_" + strings.ToUpper(strings.ReplaceAll(preset, "-", "_")) + "_" + key)
+}
+
+// llmEnv reads LLM_<PRESET>_<key>, falling back to LLM_<key>.
+func llmEnv(preset, key string) string {
+	if v := llmPresetEnv(preset, key); v != "" {
+		return v
+	}
+	return os.Getenv("LLM_" + key)
+}
+
+// resolveLLMPreset applies the environment overrides to a preset and returns
+// the endpoint it should be sent to.
+func resolveLLMPreset(name string) (llmPreset, llmEndpoint, bool) {
+	preset, ok := llmPresets[name]
+	if !ok {
+		return llmPreset{}, llmEndpoint{}, false
+	}
+
+	// the global key and model belong to the global endpoint, they would
+	// leak to or not exist at a preset's own provider
+	providerEnv := llmEnv
+	if preset.BaseURL != "" {
+		providerEnv = llmPresetEnv
+	}
+
+	if model := providerEnv(name, "MODEL"); model != "" {
+		preset.Model = model
+	}
+	if prompt := llmEnv(name, "SYSTEM_PROMPT"); prompt != "" {
+		preset.SystemPrompt = prompt
+	}
+	if n, err := strconv.Atoi(llmEnv(name, "MAX_TOKENS")); err == nil && n > 0 {
+		preset.MaxTokens = n
+	}
+
+	endpoint := llmEndpoint{
+		baseURL: providerEnv(name, "BASE_URL"),
+		apiKey:  providerEnv(name, "API_KEY"),
+	}
+	// the hosted apis reject requests without a key, leave the preset
+	// unconfigured instead of failing every request
+	if endpoint.baseURL == "" && endpoint.apiKey != "" {
+		endpoint.baseURL = preset.BaseURL
+	}
+	endpoint.baseURL = strings.TrimRight(endpoint.baseURL, "/")
+	return preset, endpoint, true
+}
+
+type llmMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type llmRequest struct {
+	Model         string            `json:"model"`
+	Messages      []llmMessage      `json:"messages"`
+	MaxTokens     int               `json:"max_tokens,omitempty"`
+	Temperature   float64           `json:"temperature"`
+	Stream        bool              `json:"stream,omitempty"`
+	StreamOptions *llmStreamOptions `json:"stream_options,omitempty"`
+}
+
+type llmUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type llmResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      llmMessage `json:"message"`
+		FinishReason string     `json:"finish_reason"`
+	} `json:"choices"`
+	Usage llmUsage `json:"usage"`
+}
+
+type llmErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e llmEndpoint) newRequest(ctx context.Context, body llmRequest) (*http.Request, error) {
+	if e.baseURL == "" {
+		return nil, errLLMNotConfigured
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	return req, nil
+}
+
+// upstreamError turns a failed response into an error carrying the message
+// of the OpenAI style error body when there is one.
+func (e llmEndpoint) upstreamError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var errResp llmErrorResponse
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
+		return fmt.Errorf("llm endpoint returned %d: %s", resp.StatusCode, errResp.Error.Message)
+	}
+	return fmt.Errorf("llm endpoint returned %d", resp.StatusCode)
+}
+
+func (e llmEndpoint) complete(ctx context.Context, body llmRequest) (*llmResponse, error) {
+	req, err := e.newRequest(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := llmClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, e.upstreamError(resp)
+	}
+
+	var result llmResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return nil, errors.New("llm endpoint returned no choices")
+	}
+	return &result, nil
+}
+
+// llmFilter inspects text sent to or returned by a model. It may rewrite the
+// text, or reject it by returning an error wrapping errLLMBlocked.
+type llmFilter func(text string) (string, error)
+
+var (
+	llmInputFilters  = []llmFilter{blockedTermsFilter}
+	llmOutputFilters = []llmFilter{blockedTermsFilter, mentionFilter}
+)
+
+func applyLLMFilters(filters []llmFilter, text string) (string, error) {
+	for _, filter := range filters {
+		var err error
+		if text, err = filter(text); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// blockedTermsFilter rejects text containing any of the comma separated
+// LLM_BLOCKED_TERMS.
+func blockedTermsFilter(text string) (string, error) {
+	lower := strings.ToLower(text)
+	for _, term := range strings.Split(os.Getenv("LLM_BLOCKED_TERMS"), ",") {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if term != "" && strings.Contains(lower, term) {
+			return "", fmt.Errorf("%w: contains blocked term", errLLMBlocked)
+		}
+	}
+	return text, nil
+}
+
+var mentionPattern = regexp.MustCompile(`@(everyone|here)|<@[!&]?\d+>`)
+
+// mentionFilter keeps model output from pinging anyone when the bot posts it.
+func mentionFilter(text string) (string, error) {
+	return mentionPattern.ReplaceAllStringFunc(text, func(m string) string {
+		return m[:1] + "\u200b" + m[1:]
+	}), nil
+}
+
+// llmRouteRequest is a validated prompt for a preset, ready to be sent.
+type llmRouteRequest struct {
+	preset   llmPreset
+	endpoint llmEndpoint
+	body     llmRequest
+}
+
+func parseLLMRequest(r *http.Request, presetName string) (*llmRouteRequest, int, string) {
+	preset, endpoint, ok := resolveLLMPreset(presetName)
+	if !ok {
+		return nil, StatusError, "unknown llm preset"
+	}
+
+	prompt := strings.TrimSpace(r.URL.Query().Get("prompt"))
+	if prompt == "" {
+		prompt = strings.TrimSpace(r.URL.Query().Get("q"))
+	}
+	if prompt == "" {
+		return nil, StatusError, "missing 'prompt' query parameter"
+	}
+	if len([]rune(prompt)) > preset.MaxPromptChars {
+		return nil, StatusError, fmt.Sprintf("prompt is longer than %d characters", preset.MaxPromptChars)
+	}
+
+	prompt, err := applyLLMFilters(llmInputFilters, prompt)
+	if err != nil {
+		return nil, StatusError, "prompt " + err.Error()
+	}
+
+	maxTokens := preset.MaxTokens
+	if v := r.URL.Query().Get("max_tokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, StatusError, "invalid 'max_tokens' query parameter"
+		}
+		maxTokens = min(n, preset.MaxTokens)
+	}
+
+	var messages []llmMessage
+	if preset.SystemPrompt != "" {
+		messages = append(messages, llmMessage{Role: "system", Content: preset.SystemPrompt})
+	}
+	messages = append(messages, llmMessage{Role: "user", Content: prompt})
+
+	return &llmRouteRequest{
+		preset:   preset,
+		endpoint: endpoint,
+		body: llmRequest{
+			Model:       preset.Model,
+			Messages:    messages,
+			MaxTokens:   maxTokens,
+			Temperature: preset.Temperature,
+		},
+	}, StatusSuccess, ""
+}
+
+func serveLLM(w http.ResponseWriter, r *http.Request, presetName string) {
+	rw := newResponseWriter(w, time.Now())
+
+	req, status, message := parseLLMRequest(r, presetName)
+	if req == nil {
+		rw.writeError(status, message)
+		return
+	}
+
+	if wantsLLMStream(r) {
+		streamLLM(w, r, req)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), llmTimeout)
+	defer cancel()
+
+	resp, err := req.endpoint.complete(ctx, req.body)
+	if err != nil {
+		if errors.Is(err, errLLMNotConfigured) {
+			rw.writeError(StatusError, err.Error())
+			return
+		}
+		rw.writeError(StatusError, "failed to generate text")
+		return
+	}
+
+	output, err := applyLLMFilters(llmOutputFilters, strings.TrimSpace(resp.Choices[0].Message.Content))
+	if err != nil {
+		rw.writeError(StatusError, "response "+err.Error())
+		return
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = req.body.Model
+	}
+
+	rw.write(map[string]interface{}{
+		"status":        StatusSuccess,
+		"preset":        req.preset.Name,
+		"model":         model,
+		"output":        output,
+		"finish_reason": resp.Choices[0].FinishReason,
+		"usage":         resp.Usage,
+	})
+}
+
+func GetGPT(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "gpt")
+}
+
+func GetGrok(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "grok")
+}
+
+func GetBard(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "bard")
+}
+
+func GetGemini(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "gemini")
+}
+
+func GetTextGenerator(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "text-generator")
+}
+
+func GetInferKit(w http.ResponseWriter, r *http.Request) {
+	serveLLM(w, r, "inferkit")
+}
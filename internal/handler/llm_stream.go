@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const llmStreamTimeout = 5 * time.Minute
+
+// streamed responses can legitimately take minutes, the request context is
+// what bounds them
+var llmStreamClient = &http.Client{}
+
+type llmStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type llmStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *llmUsage `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// wantsLLMStream reports whether the client asked for server-sent events,
+// either with stream=true or by accepting text/event-stream.
+func wantsLLMStream(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("stream")) {
+	case "true", "1":
+		return true
+	case "false", "0":
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func (e llmEndpoint) openStream(ctx context.Context, body llmRequest) (io.ReadCloser, error) {
+	body.Stream = true
+	body.StreamOptions = &llmStreamOptions{IncludeUsage: true}
+
+	req, err := e.newRequest(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := llmStreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, e.upstreamError(resp)
+	}
+	return resp.Body, nil
+}
+
+// readLLMStream calls onChunk for every data line of an OpenAI style event
+// stream until the [DONE] marker or the end of the body.
+func readLLMStream(r io.Reader, onChunk func(llmStreamChunk) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk llmStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode failed: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("llm endpoint error: %s", chunk.Error.Message)
+		}
+		if err := onChunk(chunk); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// keeps nginx from buffering the whole response
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (s *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// llmStreamRelay forwards model output to the client as it arrives. Output
+// filters may rewrite text, so only complete words are filtered and sent,
+// the unfinished last word is held back until more text or the end arrives.
+type llmStreamRelay struct {
+	sse  *sseWriter
+	raw  strings.Builder
+	sent string
+}
+
+func (l *llmStreamRelay) flush(final bool) error {
+	text := strings.TrimLeftFunc(l.raw.String(), unicode.IsSpace)
+	if !final {
+		cut := strings.LastIndexAny(text, " \t\n")
+		if cut < 0 {
+			return nil
+		}
+		text = text[:cut+1]
+	}
+
+	filtered, err := applyLLMFilters(llmOutputFilters, text)
+	if err != nil {
+		return err
+	}
+	// a filter rewrote text that was already sent, the done event carries
+	// the corrected output
+	if !strings.HasPrefix(filtered, l.sent) || len(filtered) == len(l.sent) {
+		return nil
+	}
+
+	if err := l.sse.send("delta", map[string]interface{}{"content": filtered[len(l.sent):]}); err != nil {
+		return err
+	}
+	l.sent = filtered
+	return nil
+}
+
+// streamLLM relays a completion as server-sent events: "delta" events with
+// the next piece of content, then a single "done" event shaped like the
+// regular response body, or an "error" event if generation fails midway.
+func streamLLM(w http.ResponseWriter, r *http.Request, req *llmRouteRequest) {
+	rw := newResponseWriter(w, time.Now())
+
+	ctx, cancel := context.WithTimeout(r.Context(), llmStreamTimeout)
+	defer cancel()
+
+	// errors before the first byte can still be reported as regular json
+	body, err := req.endpoint.openStream(ctx, req.body)
+	if err != nil {
+		if errors.Is(err, errLLMNotConfigured) {
+			rw.writeError(StatusError, err.Error())
+			return
+		}
+		rw.writeError(StatusError, "failed to generate text")
+		return
+	}
+	defer body.Close()
+
+	relay := &llmStreamRelay{sse: newSSEWriter(w)}
+	model := req.body.Model
+	finishReason := ""
+	var usage llmUsage
+
+	err = readLLMStream(body, func(chunk llmStreamChunk) error {
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+		if chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		relay.raw.WriteString(chunk.Choices[0].Delta.Content)
+		return relay.flush(false)
+	})
+	if err == nil {
+		err = relay.flush(true)
+	}
+
+	if err != nil {
+		message := "failed to generate text"
+		if errors.Is(err, errLLMBlocked) {
+			message = "response " + err.Error()
+		}
+		relay.sse.send("error", apiError{Status: StatusError, Message: message})
+		return
+	}
+
+	output, _ := applyLLMFilters(llmOutputFilters, strings.TrimSpace(relay.raw.String()))
+	relay.sse.send("done", map[string]interface{}{
+		"status":        StatusSuccess,
+		"preset":        req.preset.Name,
+		"model":         model,
+		"output":        output,
+		"finish_reason": finishReason,
+		"usage":         usage,
+	})
+}
@@ -0,0 +1,581 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// lyricsCandidateCount is how many alternatives are listed next to the match
+const lyricsCandidateCount = 5
+
+var errLyricsNotFound = errors.New("lyrics not found")
+
+var lrclibHeaders = map[string]string{
+	"User-Agent": "MeteorDiscordBot/1.0 (https://github.com/meteor-discord/backend)",
+}
+
+type lrclibTrack struct {
+	ID           int64   `json:"id"`
+	TrackName    string  `json:"trackName"`
+	Name         string  `json:"name"`
+	ArtistName   string  `json:"artistName"`
+	AlbumName    string  `json:"albumName"`
+	Duration     float64 `json:"duration"`
+	Instrumental bool    `json:"instrumental"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+// lyricsTrack is a lyrics match, durations are in seconds. matches from
+// providers that search metadata only have fetch set until loaded.
+type lyricsTrack struct {
+	ID           string
+	Provider     int
+	Title        string
+	Artist       string
+	Album        string
+	Duration     float64
+	Instrumental bool
+	PlainLyrics  string
+	SyncedLyrics string
+	URL          string
+	Copyright    string
+	Cached       bool `json:"-"`
+
+	fetch func() (lyricsContent, error)
+	// alternatives are the ones stored with a cached match
+	alternatives []lyricsTrack
+}
+
+type lyricsContent struct {
+	Plain     string
+	Synced    string
+	Copyright string
+}
+
+func (t lrclibTrack) toLyricsTrack() lyricsTrack {
+	title := t.TrackName
+	if title == "" {
+		title = t.Name
+	}
+	return lyricsTrack{
+		ID:           strconv.FormatInt(t.ID, 10),
+		Provider:     LyricsProviderLRCLIB,
+		Title:        title,
+		Artist:       t.ArtistName,
+		Album:        t.AlbumName,
+		Duration:     t.Duration,
+		Instrumental: t.Instrumental,
+		PlainLyrics:  t.PlainLyrics,
+		SyncedLyrics: t.SyncedLyrics,
+	}
+}
+
+func (t lyricsTrack) hasLyrics() bool {
+	return t.PlainLyrics != "" || t.SyncedLyrics != "" || t.fetch != nil
+}
+
+// lyricsStrictDurationTolerance is how far off in seconds a match may be when
+// the duration came from the track itself rather than the user
+const lyricsStrictDurationTolerance = 2
+
+// lyricsQuery is either free text or the track's metadata, the latter
+// allowing an exact lookup when album and duration are known too
+type lyricsQuery struct {
+	Text           string
+	Track          string
+	Artist         string
+	Album          string
+	Duration       float64
+	Synced         bool
+	StrictDuration bool
+}
+
+// durationMatches reports whether t is within tolerance seconds of the
+// queried duration, unknown durations always match. strict queries use
+// their own tolerance.
+func (q lyricsQuery) durationMatches(t lyricsTrack, tolerance float64) bool {
+	if q.Duration <= 0 || t.Duration <= 0 {
+		return true
+	}
+	if q.StrictDuration {
+		tolerance = lyricsStrictDurationTolerance
+	}
+	return math.Abs(q.Duration-t.Duration) <= tolerance
+}
+
+func parseLyricsQuery(query url.Values) (lyricsQuery, error) {
+	q := lyricsQuery{
+		Text:   strings.TrimSpace(query.Get("q")),
+		Track:  strings.TrimSpace(query.Get("track")),
+		Artist: strings.TrimSpace(query.Get("artist")),
+		Album:  strings.TrimSpace(query.Get("album")),
+		Synced: query.Get("synced") == "true" || query.Get("synced") == "1",
+	}
+	if raw := query.Get("duration"); raw != "" {
+		duration, err := strconv.ParseFloat(raw, 64)
+		if err != nil || duration <= 0 {
+			return q, fmt.Errorf("invalid 'duration' query parameter %q, expected seconds", raw)
+		}
+		q.Duration = duration
+	}
+	if q.Text == "" && q.Track == "" {
+		return q, errors.New("missing 'q' or 'track' query parameter")
+	}
+	return q, nil
+}
+
+func lrclibSearch(params url.Values) ([]lyricsTrack, error) {
+	var results []lrclibTrack
+	if err := fetchJSONWithHeaders("https://lrclib.net/api/search?"+params.Encode(), lrclibHeaders, &results); err != nil {
+		return nil, err
+	}
+	tracks := make([]lyricsTrack, 0, len(results))
+	for _, r := range results {
+		tracks = append(tracks, r.toLyricsTrack())
+	}
+	return tracks, nil
+}
+
+// lrclibGet fetches one track, by lrclib id or by its exact signature
+func lrclibGet(path string, params url.Values) (*lyricsTrack, error) {
+	apiURL := "https://lrclib.net/api/" + path
+	if params != nil {
+		apiURL += "?" + params.Encode()
+	}
+	var result lrclibTrack
+	if err := fetchJSONWithHeaders(apiURL, lrclibHeaders, &result); err != nil {
+		if isNotFoundError(err) {
+			return nil, errLyricsNotFound
+		}
+		return nil, err
+	}
+	track := result.toLyricsTrack()
+	return &track, nil
+}
+
+// lrclibFind looks the track up exactly when the whole signature is known
+// and searches otherwise, or when the exact lookup has nothing
+func lrclibFind(q lyricsQuery) ([]lyricsTrack, error) {
+	if q.Track != "" && q.Artist != "" && q.Album != "" && q.Duration > 0 {
+		params := url.Values{
+			"track_name":  {q.Track},
+			"artist_name": {q.Artist},
+			"album_name":  {q.Album},
+			"duration":    {strconv.Itoa(int(math.Round(q.Duration)))},
+		}
+		track, err := lrclibGet("get", params)
+		if err == nil {
+			return []lyricsTrack{*track}, nil
+		}
+		if !errors.Is(err, errLyricsNotFound) {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	if q.Track != "" {
+		params.Set("track_name", q.Track)
+		if q.Artist != "" {
+			params.Set("artist_name", q.Artist)
+		}
+	} else {
+		params.Set("q", q.Text)
+	}
+	return lrclibSearch(params)
+}
+
+var (
+	lyricsBracketPattern = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+	// "Song - Remastered 2011", "Song - Live at ..." and the like
+	lyricsSuffixPattern = regexp.MustCompile(`(?i)\s+-\s+.*\b(remaster(ed)?|live|version|edit|mix|mono|stereo|acoustic)\b.*$`)
+)
+
+// normalizeLyricsText reduces titles and artists to comparable words,
+// dropping featured artists, remaster notes and punctuation
+func normalizeLyricsText(s string) string {
+	s = lyricsSuffixPattern.ReplaceAllString(s, "")
+	s = lyricsBracketPattern.ReplaceAllString(s, " ")
+	s = strings.ToLower(s)
+	if i := strings.Index(s, " feat. "); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, " ft. "); i >= 0 {
+		s = s[:i]
+	}
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// textSimilarity scores two names from 0 to 1
+func textSimilarity(a, b string) float64 {
+	a, b = normalizeLyricsText(a), normalizeLyricsText(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return 0.7
+	}
+	return tokenOverlap(a, b) * 0.6
+}
+
+// tokenOverlap is the share of a's words found in b
+func tokenOverlap(a, b string) float64 {
+	wordsA := strings.Fields(normalizeLyricsText(a))
+	if len(wordsA) == 0 {
+		return 0
+	}
+	wordsB := map[string]bool{}
+	for _, w := range strings.Fields(normalizeLyricsText(b)) {
+		wordsB[w] = true
+	}
+	found := 0
+	for _, w := range wordsA {
+		if wordsB[w] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(wordsA))
+}
+
+func scoreLyricsMatch(q lyricsQuery, t lyricsTrack) float64 {
+	score := 0.0
+	if q.Track != "" {
+		score += 3 * textSimilarity(q.Track, t.Title)
+	}
+	if q.Artist != "" {
+		score += 2 * textSimilarity(q.Artist, t.Artist)
+	}
+	if q.Album != "" {
+		score += 0.5 * textSimilarity(q.Album, t.Album)
+	}
+	if q.Text != "" {
+		score += 3 * tokenOverlap(q.Text, t.Artist+" "+t.Title)
+	}
+
+	if q.Duration > 0 && t.Duration > 0 {
+		switch diff := math.Abs(q.Duration - t.Duration); {
+		case diff <= 2:
+			score += 2
+		case diff <= 5:
+			score += 1
+		case diff > 15:
+			score -= 2
+		}
+	}
+
+	switch {
+	case !t.hasLyrics() && !t.Instrumental:
+		score -= 5
+	case q.Synced && t.SyncedLyrics != "":
+		score += 2
+	case t.SyncedLyrics != "":
+		score += 0.25
+	}
+	return score
+}
+
+// rankLyrics orders the matches best first, keeping the upstream order for
+// equal scores since it already reflects popularity
+func rankLyrics(q lyricsQuery, tracks []lyricsTrack) []lyricsTrack {
+	scores := make(map[int]float64, len(tracks))
+	indexed := make([]int, len(tracks))
+	for i, t := range tracks {
+		indexed[i] = i
+		scores[i] = scoreLyricsMatch(q, t)
+	}
+	sort.SliceStable(indexed, func(a, b int) bool {
+		return scores[indexed[a]] > scores[indexed[b]]
+	})
+
+	ranked := make([]lyricsTrack, len(tracks))
+	for i, idx := range indexed {
+		ranked[i] = tracks[idx]
+	}
+	return ranked
+}
+
+type lyricsLine struct {
+	Time int64
+	Text string
+}
+
+var (
+	lrcTimestampPattern = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+	lrcOffsetPattern    = regexp.MustCompile(`(?i)^\[offset:\s*([+-]?\d+)\s*\]`)
+)
+
+// parseLRC turns LRC lyrics into lines ordered by time in ms. a line can have
+// several timestamps when it repeats, and the offset tag shifts everything.
+func parseLRC(lrc string) []lyricsLine {
+	var lines []lyricsLine
+	offset := int64(0)
+
+	for _, raw := range strings.Split(lrc, "\n") {
+		raw = strings.TrimSpace(raw)
+		if m := lrcOffsetPattern.FindStringSubmatch(raw); m != nil {
+			offset, _ = strconv.ParseInt(m[1], 10, 64)
+			continue
+		}
+
+		var times []int64
+		for {
+			m := lrcTimestampPattern.FindStringSubmatch(raw)
+			if m == nil {
+				break
+			}
+			minutes, _ := strconv.ParseInt(m[1], 10, 64)
+			seconds, _ := strconv.ParseInt(m[2], 10, 64)
+			ms := int64(0)
+			if m[3] != "" {
+				// ".5" is half a second, ".05" and ".050" are both 50ms
+				frac := m[3] + strings.Repeat("0", 3-len(m[3]))
+				ms, _ = strconv.ParseInt(frac, 10, 64)
+			}
+			times = append(times, (minutes*60+seconds)*1000+ms)
+			raw = raw[len(m[0]):]
+		}
+
+		text := strings.TrimSpace(raw)
+		for _, t := range times {
+			// a positive offset makes the lyrics appear sooner
+			lines = append(lines, lyricsLine{Time: max(t-offset, 0), Text: text})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+	return lines
+}
+
+func buildSyncedLyrics(lines []lyricsLine) []map[string]interface{} {
+	synced := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		synced = append(synced, map[string]interface{}{
+			"time": line.Time,
+			"text": line.Text,
+		})
+	}
+	return synced
+}
+
+// plainFromSynced is the fallback for tracks that only have synced lyrics
+func plainFromSynced(lines []lyricsLine) string {
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+func formatTrackDuration(seconds float64) string {
+	total := int(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// currentLyricsLine finds the line being sung at position ms, -1 before the
+// first line starts
+func currentLyricsLine(lines []lyricsLine, position int64) int {
+	return sort.Search(len(lines), func(i int) bool {
+		return lines[i].Time > position
+	}) - 1
+}
+
+func buildLyricsLine(lines []lyricsLine, index int) interface{} {
+	if index < 0 || index >= len(lines) {
+		return nil
+	}
+	return map[string]interface{}{
+		"index": index,
+		"time":  lines[index].Time,
+		"text":  lines[index].Text,
+	}
+}
+
+func buildLyricsCandidate(t lyricsTrack) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           t.ID,
+		"provider":     t.Provider,
+		"title":        t.Title,
+		"artist":       t.Artist,
+		"album":        t.Album,
+		"duration":     t.Duration,
+		"synced":       t.SyncedLyrics != "",
+		"instrumental": t.Instrumental,
+	}
+}
+
+func SearchLyrics(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+	query := r.URL.Query()
+
+	position := int64(-1)
+	if raw := query.Get("position"); raw != "" {
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms < 0 {
+			rw.writeError(StatusError, fmt.Sprintf("invalid 'position' query parameter %q, expected milliseconds", raw))
+			return
+		}
+		position = ms
+	}
+	// following along needs the timestamps, so a position asks for synced lyrics
+	synced := query.Get("synced") == "true" || query.Get("synced") == "1" || position >= 0
+
+	var (
+		result     *lyricsTrack
+		candidates []lyricsTrack
+		q          lyricsQuery
+		meta       *trackMetadata
+	)
+	if id := query.Get("id"); id != "" {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			rw.writeError(StatusError, "invalid 'id' query parameter")
+			return
+		}
+		track, err := lrclibGet("get/"+id, nil)
+		if err != nil {
+			if errors.Is(err, errLyricsNotFound) {
+				rw.writeError(StatusNotFound, err.Error())
+			} else {
+				rw.writeError(StatusError, "failed to fetch lyrics")
+			}
+			return
+		}
+		if !track.hasLyrics() {
+			rw.writeError(StatusNotFound, "lyrics not found")
+			return
+		}
+		result = track
+		q.Synced = synced
+	} else if query.Get("spotify_id") != "" || query.Get("isrc") != "" {
+		var spotifyID, isrc string
+		if raw := query.Get("spotify_id"); raw != "" {
+			id, ok := parseSpotifyTrackID(raw)
+			if !ok {
+				rw.writeError(StatusError, "invalid 'spotify_id' query parameter")
+				return
+			}
+			spotifyID = id
+		} else {
+			code, ok := parseISRC(query.Get("isrc"))
+			if !ok {
+				rw.writeError(StatusError, "invalid 'isrc' query parameter")
+				return
+			}
+			isrc = code
+		}
+
+		var err error
+		meta, err = resolveTrackMetadata(spotifyID, isrc)
+		if err != nil {
+			if errors.Is(err, errTrackNotFound) {
+				rw.writeError(StatusNotFound, err.Error())
+			} else {
+				rw.writeError(StatusError, "failed to resolve track")
+			}
+			return
+		}
+		q = meta.lyricsQuery()
+		q.Synced = synced
+		result, candidates, err = findLyrics(q)
+		if err != nil {
+			if errors.Is(err, errLyricsNotFound) {
+				rw.writeError(StatusNotFound, err.Error())
+			} else {
+				rw.writeError(StatusError, "failed to fetch lyrics")
+			}
+			return
+		}
+	} else {
+		var err error
+		q, err = parseLyricsQuery(query)
+		if err != nil {
+			rw.writeError(StatusError, err.Error())
+			return
+		}
+		q.Synced = synced
+		result, candidates, err = findLyrics(q)
+		if err != nil {
+			if errors.Is(err, errLyricsNotFound) {
+				rw.writeError(StatusNotFound, err.Error())
+			} else {
+				rw.writeError(StatusError, "failed to fetch lyrics")
+			}
+			return
+		}
+	}
+
+	lines := parseLRC(result.SyncedLyrics)
+	lyrics := result.PlainLyrics
+	if lyrics == "" {
+		lyrics = plainFromSynced(lines)
+	}
+
+	metadata := []map[string]interface{}{
+		{"id": "Album", "value": result.Album},
+	}
+	if result.Duration > 0 {
+		metadata = append(metadata, map[string]interface{}{"id": "Duration", "value": formatTrackDuration(result.Duration)})
+	}
+
+	track := map[string]interface{}{
+		"id":       result.ID,
+		"title":    result.Title,
+		"artist":   result.Artist,
+		"duration": result.Duration,
+		"metadata": metadata,
+	}
+	if meta != nil {
+		track["isrc"] = meta.ISRC
+		track["spotify_id"] = meta.SpotifyID
+	}
+
+	response := map[string]interface{}{
+		"status":          StatusSuccess,
+		"lyrics":          lyrics,
+		"lyrics_provider": result.Provider,
+		"attribution":     lyricsAttribution(*result),
+		"track":           track,
+		"instrumental":    result.Instrumental,
+		"cached":          result.Cached,
+	}
+	if q.Synced {
+		if len(lines) > 0 {
+			response["synced"] = buildSyncedLyrics(lines)
+		} else {
+			response["synced"] = nil
+		}
+	}
+	if position >= 0 {
+		index := currentLyricsLine(lines, position)
+		response["position"] = position
+		response["current_line"] = buildLyricsLine(lines, index)
+		response["next_line"] = buildLyricsLine(lines, index+1)
+	}
+
+	alternatives := []map[string]interface{}{}
+	for _, t := range candidates {
+		if len(alternatives) == lyricsCandidateCount {
+			break
+		}
+		alternatives = append(alternatives, buildLyricsCandidate(t))
+	}
+	response["candidates"] = alternatives
+
+	rw.write(response)
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errTrackNotFound = errors.New("track not found")
+
+var (
+	spotifyTrackIDPattern = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+	isrcPattern           = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+)
+
+// trackMetadata is what the lyrics providers are queried with when the bot
+// only knows a spotify track or an isrc, durations are in seconds
+type trackMetadata struct {
+	Title     string
+	Artist    string
+	Album     string
+	Duration  float64
+	ISRC      string
+	SpotifyID string
+}
+
+func (m *trackMetadata) lyricsQuery() lyricsQuery {
+	return lyricsQuery{
+		Track:          m.Title,
+		Artist:         m.Artist,
+		Album:          m.Album,
+		Duration:       m.Duration,
+		StrictDuration: m.Duration > 0,
+	}
+}
+
+// parseSpotifyTrackID accepts a bare id, a spotify:track: uri or an
+// open.spotify.com link
+func parseSpotifyTrackID(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if id, ok := strings.CutPrefix(raw, "spotify:track:"); ok {
+		raw = id
+	} else if u, err := url.Parse(raw); err == nil && strings.HasSuffix(u.Host, "spotify.com") {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) < 2 || parts[len(parts)-2] != "track" {
+			return "", false
+		}
+		raw = parts[len(parts)-1]
+	}
+	return raw, spotifyTrackIDPattern.MatchString(raw)
+}
+
+func parseISRC(raw string) (string, bool) {
+	isrc := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(raw), "-", ""))
+	return isrc, isrcPattern.MatchString(isrc)
+}
+
+type trackMetadataResolver interface {
+	name() string
+	bySpotifyID(id string) (*trackMetadata, error)
+	byISRC(isrc string) (*trackMetadata, error)
+}
+
+// trackMetadataResolvers prefers the spotify api when a client is configured,
+// it knows every spotify track. musicbrainz only knows the ones its editors
+// linked, but needs no credentials.
+func trackMetadataResolvers() []trackMetadataResolver {
+	var resolvers []trackMetadataResolver
+	if id, secret := os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"); id != "" && secret != "" {
+		resolvers = append(resolvers, &spotifyResolver{clientID: id, clientSecret: secret})
+	}
+	return append(resolvers, &musicbrainzResolver{})
+}
+
+func resolveTrackMetadata(spotifyID, isrc string) (*trackMetadata, error) {
+	var lastErr error = errTrackNotFound
+	for _, resolver := range trackMetadataResolvers() {
+		var (
+			meta *trackMetadata
+			err  error
+		)
+		if spotifyID != "" {
+			meta, err = resolver.bySpotifyID(spotifyID)
+		} else {
+			meta, err = resolver.byISRC(isrc)
+		}
+		if err == nil {
+			if meta.SpotifyID == "" {
+				meta.SpotifyID = spotifyID
+			}
+			if meta.ISRC == "" {
+				meta.ISRC = isrc
+			}
+			return meta, nil
+		}
+		if !errors.Is(err, errTrackNotFound) {
+			log.Printf("track metadata resolver %s failed: %v", resolver.name(), err)
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+type spotifyTrack struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DurationMs int64  `json:"duration_ms"`
+	Artists    []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	Album struct {
+		Name string `json:"name"`
+	} `json:"album"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+}
+
+func (t spotifyTrack) toMetadata() *trackMetadata {
+	meta := &trackMetadata{
+		Title:     t.Name,
+		Album:     t.Album.Name,
+		Duration:  float64(t.DurationMs) / 1000,
+		ISRC:      t.ExternalIDs.ISRC,
+		SpotifyID: t.ID,
+	}
+	if len(t.Artists) > 0 {
+		meta.Artist = t.Artists[0].Name
+	}
+	return meta
+}
+
+// spotifyResolver uses the client credentials flow, the token is shared and
+// renewed shortly before it expires
+type spotifyResolver struct {
+	clientID     string
+	clientSecret string
+}
+
+var spotifyToken struct {
+	sync.Mutex
+	value     string
+	expiresAt time.Time
+}
+
+func (s *spotifyResolver) name() string {
+	return "spotify"
+}
+
+func (s *spotifyResolver) token() (string, error) {
+	spotifyToken.Lock()
+	defer spotifyToken.Unlock()
+
+	if spotifyToken.value != "" && time.Now().Before(spotifyToken.expiresAt) {
+		return spotifyToken.value, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(s.clientID, s.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusCodeError{code: resp.StatusCode}
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode failed: %w", err)
+	}
+	spotifyToken.value = token.AccessToken
+	spotifyToken.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return token.AccessToken, nil
+}
+
+func (s *spotifyResolver) get(path string, target interface{}) error {
+	token, err := s.token()
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	if err := fetchJSONWithHeaders("https://api.spotify.com/v1/"+path, headers, target); err != nil {
+		if isNotFoundError(err) {
+			return errTrackNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *spotifyResolver) bySpotifyID(id string) (*trackMetadata, error) {
+	var track spotifyTrack
+	if err := s.get("tracks/"+id, &track); err != nil {
+		return nil, err
+	}
+	return track.toMetadata(), nil
+}
+
+func (s *spotifyResolver) byISRC(isrc string) (*trackMetadata, error) {
+	var result struct {
+		Tracks struct {
+			Items []spotifyTrack `json:"items"`
+		} `json:"tracks"`
+	}
+	if err := s.get("search?type=track&limit=1&q="+url.QueryEscape("isrc:"+isrc), &result); err != nil {
+		return nil, err
+	}
+	if len(result.Tracks.Items) == 0 {
+		return nil, errTrackNotFound
+	}
+	return result.Tracks.Items[0].toMetadata(), nil
+}
+
+// musicbrainzHeaders identify us as musicbrainz asks, anonymous clients get
+// throttled hard
+var musicbrainzHeaders = map[string]string{
+	"User-Agent": "MeteorDiscordBot/1.0 (https://github.com/meteor-discord/backend)",
+	"Accept":     "application/json",
+}
+
+type musicbrainzRecording struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	Length       int64    `json:"length"`
+	ISRCs        []string `json:"isrcs"`
+	ArtistCredit []struct {
+		Name string `json:"name"`
+	} `json:"artist-credit"`
+	Releases []struct {
+		Title string `json:"title"`
+	} `json:"releases"`
+}
+
+func (r musicbrainzRecording) toMetadata() *trackMetadata {
+	meta := &trackMetadata{
+		Title:    r.Title,
+		Duration: float64(r.Length) / 1000,
+	}
+	if len(r.ArtistCredit) > 0 {
+		meta.Artist = r.ArtistCredit[0].Name
+	}
+	if len(r.Releases) > 0 {
+		meta.Album = r.Releases[0].Title
+	}
+	if len(r.ISRCs) > 0 {
+		meta.ISRC = r.ISRCs[0]
+	}
+	return meta
+}
+
+type musicbrainzResolver struct{}
+
+func (m *musicbrainzResolver) name() string {
+	return "musicbrainz"
+}
+
+func (m *musicbrainzResolver) get(path string, params url.Values, target interface{}) error {
+	params.Set("fmt", "json")
+	if err := fetchJSONWithHeaders("https://musicbrainz.org/ws/2/"+path+"?"+params.Encode(), musicbrainzHeaders, target); err != nil {
+		if isNotFoundError(err) {
+			return errTrackNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// bySpotifyID goes through the url entity, spotify links are attached to
+// recordings as relationships
+func (m *musicbrainzResolver) bySpotifyID(id string) (*trackMetadata, error) {
+	var link struct {
+		Relations []struct {
+			Recording *struct {
+				ID string `json:"id"`
+			} `json:"recording"`
+		} `json:"relations"`
+	}
+	params := url.Values{"resource": {"https://open.spotify.com/track/" + id}, "inc": {"recording-rels"}}
+	if err := m.get("url", params, &link); err != nil {
+		return nil, err
+	}
+
+	for _, rel := range link.Relations {
+		if rel.Recording == nil {
+			continue
+		}
+		var recording musicbrainzRecording
+		if err := m.get("recording/"+rel.Recording.ID, url.Values{"inc": {"artist-credits+releases+isrcs"}}, &recording); err != nil {
+			return nil, err
+		}
+		return recording.toMetadata(), nil
+	}
+	return nil, errTrackNotFound
+}
+
+func (m *musicbrainzResolver) byISRC(isrc string) (*trackMetadata, error) {
+	var result struct {
+		Recordings []musicbrainzRecording `json:"recordings"`
+	}
+	if err := m.get("isrc/"+isrc, url.Values{"inc": {"artist-credits+releases"}}, &result); err != nil {
+		return nil, err
+	}
+
+	// the same isrc can be on several recordings, prefer one with a length
+	// since that is what the lyrics get matched against
+	for _, recording := range result.Recordings {
+		if recording.Length > 0 {
+			meta := recording.toMetadata()
+			meta.ISRC = isrc
+			return meta, nil
+		}
+	}
+	if len(result.Recordings) > 0 {
+		meta := result.Recordings[0].toMetadata()
+		meta.ISRC = isrc
+		return meta, nil
+	}
+	return nil, errTrackNotFound
+}
@@ -0,0 +1,605 @@
+package handler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	LyricsProviderGenius     = 1
+	LyricsProviderMusixmatch = 2
+	LyricsProviderLRCLIB     = 3
+)
+
+// lyricsLoadAttempts caps how many matches of one provider get their lyrics
+// fetched before moving on, for providers that only search metadata
+const lyricsLoadAttempts = 3
+
+// the LYRICS_CACHE_DIR entries expire like the memory ones, just later, and
+// the oldest files go once there are too many
+const (
+	lyricsDiskCacheTTL      = 30 * 24 * time.Hour
+	lyricsDiskCacheMaxFiles = 10000
+	lyricsDiskPruneInterval = 10 * time.Minute
+)
+
+var lyricsMemoryCache = newTTLCache[cachedLyrics](24*time.Hour, 2000)
+
+var lyricsDiskPrune struct {
+	sync.Mutex
+	last time.Time
+}
+
+// cachedLyrics is a cache entry. the alternatives are kept along with the
+// match so a cache hit still lists them.
+type cachedLyrics struct {
+	Track        lyricsTrack
+	Alternatives []lyricsTrack
+	CachedAt     time.Time
+}
+
+type lyricsProvider interface {
+	name() string
+	find(q lyricsQuery) ([]lyricsTrack, error)
+}
+
+func lyricsProviders() []lyricsProvider {
+	names := os.Getenv("LYRICS_PROVIDERS")
+	if names == "" {
+		names = "cache,lrclib,musixmatch,genius"
+	}
+
+	var providers []lyricsProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "cache":
+			providers = append(providers, &cacheLyricsProvider{dir: os.Getenv("LYRICS_CACHE_DIR")})
+		case "lrclib":
+			providers = append(providers, &lrclibProvider{})
+		case "musixmatch":
+			if p := newMusixmatchProvider(); p != nil {
+				providers = append(providers, p)
+			}
+		case "genius":
+			if p := newGeniusProvider(); p != nil {
+				providers = append(providers, p)
+			}
+		}
+	}
+	return providers
+}
+
+// lyricsAttribution names where the lyrics came from, lyrics are licensed
+// and the providers require credit
+func lyricsAttribution(t lyricsTrack) map[string]interface{} {
+	attribution := map[string]interface{}{"provider": t.Provider}
+	switch t.Provider {
+	case LyricsProviderGenius:
+		attribution["name"] = "Genius"
+		attribution["url"] = t.URL
+	case LyricsProviderMusixmatch:
+		attribution["name"] = "Musixmatch"
+		attribution["url"] = t.URL
+	case LyricsProviderLRCLIB:
+		attribution["name"] = "LRCLIB"
+		attribution["url"] = "https://lrclib.net"
+	}
+	if t.Copyright != "" {
+		attribution["copyright"] = t.Copyright
+	}
+	return attribution
+}
+
+// lyricsMatchAcceptable decides whether a provider's best match is good
+// enough to stop at, or whether the next provider should be asked
+func lyricsMatchAcceptable(q lyricsQuery, t lyricsTrack) bool {
+	if !t.hasLyrics() {
+		return false
+	}
+	if !q.durationMatches(t, 10) {
+		return false
+	}
+	if q.Track == "" {
+		return tokenOverlap(t.Artist+" "+t.Title, q.Text) >= 0.6 || tokenOverlap(t.Title, q.Text) == 1
+	}
+	return textSimilarity(q.Track, t.Title) >= 0.7 && (q.Artist == "" || textSimilarity(q.Artist, t.Artist) >= 0.6)
+}
+
+// findLyrics asks the providers in order and stops at the first acceptable
+// match. when none is, the best scoring match of all of them is returned.
+// the other matches are returned as alternatives.
+func findLyrics(q lyricsQuery) (*lyricsTrack, []lyricsTrack, error) {
+	providers := lyricsProviders()
+	if len(providers) == 0 {
+		return nil, nil, errors.New("no lyrics providers configured")
+	}
+
+	var (
+		all     []lyricsTrack
+		lastErr error
+		ok      int
+	)
+	for _, p := range providers {
+		tracks, err := p.find(q)
+		if err != nil {
+			log.Printf("lyrics provider %s failed: %v", p.name(), err)
+			lastErr = fmt.Errorf("%s: %w", p.name(), err)
+			continue
+		}
+		ok++
+		tracks = rankLyrics(q, tracks)
+		all = append(all, tracks...)
+
+		attempts := 0
+		for i := range tracks {
+			if attempts == lyricsLoadAttempts || !lyricsMatchAcceptable(q, tracks[i]) {
+				break
+			}
+			attempts++
+			if err := tracks[i].load(); err != nil {
+				continue
+			}
+			alternatives := lyricsAlternatives(all, tracks[i])
+			rememberLyrics(q, tracks[i], alternatives)
+			return &tracks[i], alternatives, nil
+		}
+	}
+	if ok == 0 {
+		return nil, nil, lastErr
+	}
+
+	all = rankLyrics(q, all)
+	for i := range all {
+		if !all[i].hasLyrics() || (q.StrictDuration && !q.durationMatches(all[i], 0)) {
+			continue
+		}
+		if err := all[i].load(); err != nil {
+			continue
+		}
+		alternatives := lyricsAlternatives(all, all[i])
+		rememberLyrics(q, all[i], alternatives)
+		return &all[i], alternatives, nil
+	}
+	return nil, nil, errLyricsNotFound
+}
+
+func lyricsAlternatives(all []lyricsTrack, chosen lyricsTrack) []lyricsTrack {
+	if chosen.Cached {
+		return chosen.alternatives
+	}
+	var alternatives []lyricsTrack
+	for _, t := range all {
+		if (t.Provider == chosen.Provider && t.ID == chosen.ID) || t.Cached || !t.hasLyrics() {
+			continue
+		}
+		alternatives = append(alternatives, t)
+	}
+	return alternatives
+}
+
+// load fetches the lyrics of matches that came from a metadata search
+func (t *lyricsTrack) load() error {
+	if t.fetch == nil {
+		return nil
+	}
+	content, err := t.fetch()
+	if err != nil {
+		return err
+	}
+	if content.Plain == "" && content.Synced == "" {
+		return errLyricsNotFound
+	}
+	t.PlainLyrics, t.SyncedLyrics, t.fetch = content.Plain, content.Synced, nil
+	if content.Copyright != "" {
+		t.Copyright = content.Copyright
+	}
+	return nil
+}
+
+func lyricsCacheKeys(q lyricsQuery, t lyricsTrack) []string {
+	keys := []string{"track\x00" + normalizeLyricsText(t.Artist) + "\x00" + normalizeLyricsText(t.Title)}
+	if q.Track != "" {
+		keys = append(keys, "track\x00"+normalizeLyricsText(q.Artist)+"\x00"+normalizeLyricsText(q.Track))
+	} else if q.Text != "" {
+		keys = append(keys, "q\x00"+normalizeLyricsText(q.Text))
+	}
+	return keys
+}
+
+func rememberLyrics(q lyricsQuery, t lyricsTrack, alternatives []lyricsTrack) {
+	if t.Cached {
+		return
+	}
+	entry := cachedLyrics{
+		Track:        t,
+		Alternatives: alternatives[:min(len(alternatives), lyricsCandidateCount)],
+		CachedAt:     time.Now(),
+	}
+	dir := os.Getenv("LYRICS_CACHE_DIR")
+	for _, key := range lyricsCacheKeys(q, t) {
+		lyricsMemoryCache.set(key, entry)
+		if dir == "" {
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		if err := os.WriteFile(lyricsCachePath(dir, key), data, 0o644); err != nil {
+			log.Printf("failed to write lyrics cache: %v", err)
+		}
+	}
+	if dir != "" {
+		go pruneLyricsCache(dir)
+	}
+}
+
+// pruneLyricsCache removes expired files and the oldest ones past
+// lyricsDiskCacheMaxFiles, at most once per lyricsDiskPruneInterval
+func pruneLyricsCache(dir string) {
+	lyricsDiskPrune.Lock()
+	defer lyricsDiskPrune.Unlock()
+	if time.Since(lyricsDiskPrune.last) < lyricsDiskPruneInterval {
+		return
+	}
+	lyricsDiskPrune.last = time.Now()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("failed to read lyrics cache: %v", err)
+		return
+	}
+
+	type cacheFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []cacheFile
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if time.Since(info.ModTime()) > lyricsDiskCacheTTL {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, cacheFile{path: path, modTime: info.ModTime()})
+	}
+	if len(files) <= lyricsDiskCacheMaxFiles {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files[:len(files)-lyricsDiskCacheMaxFiles] {
+		os.Remove(f.path)
+	}
+}
+
+func lyricsCachePath(dir, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// cacheLyricsProvider serves lyrics the other providers found before, from
+// memory and from LYRICS_CACHE_DIR when set so they survive restarts. matches
+// keep the provider they came from for attribution.
+type cacheLyricsProvider struct {
+	dir string
+}
+
+func (c *cacheLyricsProvider) name() string {
+	return "cache"
+}
+
+func (c *cacheLyricsProvider) find(q lyricsQuery) ([]lyricsTrack, error) {
+	key := "q\x00" + normalizeLyricsText(q.Text)
+	if q.Track != "" {
+		key = "track\x00" + normalizeLyricsText(q.Artist) + "\x00" + normalizeLyricsText(q.Track)
+	}
+
+	entry, ok := lyricsMemoryCache.get(key)
+	if !ok && c.dir != "" {
+		path := lyricsCachePath(c.dir, key)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil
+		}
+		if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.CachedAt) > lyricsDiskCacheTTL {
+			os.Remove(path)
+			return nil, nil
+		}
+		lyricsMemoryCache.set(key, entry)
+		ok = true
+	}
+	if !ok {
+		return nil, nil
+	}
+	track := entry.Track
+	track.Cached = true
+	track.alternatives = entry.Alternatives
+	return []lyricsTrack{track}, nil
+}
+
+type lrclibProvider struct{}
+
+func (l *lrclibProvider) name() string {
+	return "lrclib"
+}
+
+func (l *lrclibProvider) find(q lyricsQuery) ([]lyricsTrack, error) {
+	return lrclibFind(q)
+}
+
+// musixmatchProvider talks to the musixmatch api or anything implementing
+// its track.search, track.lyrics.get and track.subtitle.get methods
+type musixmatchProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+func newMusixmatchProvider() *musixmatchProvider {
+	p := &musixmatchProvider{
+		baseURL: strings.TrimRight(os.Getenv("MUSIXMATCH_API_URL"), "/"),
+		apiKey:  os.Getenv("MUSIXMATCH_API_KEY"),
+	}
+	if p.baseURL == "" {
+		if p.apiKey == "" {
+			return nil
+		}
+		p.baseURL = "https://api.musixmatch.com/ws/1.1"
+	}
+	return p
+}
+
+func (m *musixmatchProvider) name() string {
+	return "musixmatch"
+}
+
+type musixmatchEnvelope struct {
+	Message struct {
+		Header struct {
+			StatusCode int `json:"status_code"`
+		} `json:"header"`
+		// an empty body is sent as [] rather than {}
+		Body json.RawMessage `json:"body"`
+	} `json:"message"`
+}
+
+func (m *musixmatchProvider) call(method string, params url.Values, target interface{}) error {
+	if m.apiKey != "" {
+		params.Set("apikey", m.apiKey)
+	}
+	params.Set("format", "json")
+
+	var envelope musixmatchEnvelope
+	if err := fetchJSON(m.baseURL+"/"+method+"?"+params.Encode(), &envelope); err != nil {
+		return err
+	}
+	switch envelope.Message.Header.StatusCode {
+	case 200:
+	case 404:
+		return errLyricsNotFound
+	default:
+		return &statusCodeError{code: envelope.Message.Header.StatusCode}
+	}
+	if len(envelope.Message.Body) == 0 || envelope.Message.Body[0] != '{' {
+		return errLyricsNotFound
+	}
+	return json.Unmarshal(envelope.Message.Body, target)
+}
+
+type musixmatchTrack struct {
+	TrackID       int64  `json:"track_id"`
+	TrackName     string `json:"track_name"`
+	ArtistName    string `json:"artist_name"`
+	AlbumName     string `json:"album_name"`
+	TrackLength   int    `json:"track_length"`
+	Instrumental  int    `json:"instrumental"`
+	HasLyrics     int    `json:"has_lyrics"`
+	HasSubtitles  int    `json:"has_subtitles"`
+	TrackShareURL string `json:"track_share_url"`
+}
+
+func (m *musixmatchProvider) find(q lyricsQuery) ([]lyricsTrack, error) {
+	params := url.Values{
+		"page_size":      {"10"},
+		"s_track_rating": {"desc"},
+		"f_has_lyrics":   {"1"},
+	}
+	if q.Track != "" {
+		params.Set("q_track", q.Track)
+		if q.Artist != "" {
+			params.Set("q_artist", q.Artist)
+		}
+	} else {
+		params.Set("q", q.Text)
+	}
+
+	var body struct {
+		TrackList []struct {
+			Track musixmatchTrack `json:"track"`
+		} `json:"track_list"`
+	}
+	if err := m.call("track.search", params, &body); err != nil {
+		if errors.Is(err, errLyricsNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var tracks []lyricsTrack
+	for _, item := range body.TrackList {
+		t := item.Track
+		track := lyricsTrack{
+			ID:           strconv.FormatInt(t.TrackID, 10),
+			Provider:     LyricsProviderMusixmatch,
+			Title:        t.TrackName,
+			Artist:       t.ArtistName,
+			Album:        t.AlbumName,
+			Duration:     float64(t.TrackLength),
+			Instrumental: t.Instrumental == 1,
+			URL:          t.TrackShareURL,
+		}
+		if t.HasLyrics == 1 {
+			track.fetch = m.lyricsFetcher(track.ID, t.HasSubtitles == 1)
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// musixmatchFooter is appended to lyrics of the free api tier
+const musixmatchFooter = "*******"
+
+func (m *musixmatchProvider) lyricsFetcher(trackID string, hasSubtitles bool) func() (lyricsContent, error) {
+	return func() (lyricsContent, error) {
+		var lyrics struct {
+			Lyrics struct {
+				Body      string `json:"lyrics_body"`
+				Copyright string `json:"lyrics_copyright"`
+			} `json:"lyrics"`
+		}
+		if err := m.call("track.lyrics.get", url.Values{"track_id": {trackID}}, &lyrics); err != nil {
+			return lyricsContent{}, err
+		}
+		plain := lyrics.Lyrics.Body
+		if i := strings.Index(plain, musixmatchFooter); i >= 0 {
+			plain = plain[:i]
+		}
+		content := lyricsContent{
+			Plain:     strings.TrimSpace(plain),
+			Copyright: strings.TrimSpace(lyrics.Lyrics.Copyright),
+		}
+
+		if hasSubtitles {
+			var subtitle struct {
+				Subtitle struct {
+					Body string `json:"subtitle_body"`
+				} `json:"subtitle"`
+			}
+			params := url.Values{"track_id": {trackID}, "subtitle_format": {"lrc"}}
+			if err := m.call("track.subtitle.get", params, &subtitle); err == nil {
+				content.Synced = subtitle.Subtitle.Body
+			}
+		}
+		return content, nil
+	}
+}
+
+// geniusProvider searches the genius api, or a compatible one, and reads the
+// lyrics from the song page since the api does not serve them
+type geniusProvider struct {
+	baseURL string
+	token   string
+}
+
+func newGeniusProvider() *geniusProvider {
+	p := &geniusProvider{
+		baseURL: strings.TrimRight(os.Getenv("GENIUS_API_URL"), "/"),
+		token:   os.Getenv("GENIUS_ACCESS_TOKEN"),
+	}
+	if p.baseURL == "" {
+		if p.token == "" {
+			return nil
+		}
+		p.baseURL = "https://api.genius.com"
+	}
+	return p
+}
+
+func (g *geniusProvider) name() string {
+	return "genius"
+}
+
+func (g *geniusProvider) find(q lyricsQuery) ([]lyricsTrack, error) {
+	text := q.Text
+	if q.Track != "" {
+		text = strings.TrimSpace(q.Artist + " " + q.Track)
+	}
+
+	headers := map[string]string{}
+	if g.token != "" {
+		headers["Authorization"] = "Bearer " + g.token
+	}
+	var resp struct {
+		Response struct {
+			Hits []struct {
+				Type   string `json:"type"`
+				Result struct {
+					ID            int64  `json:"id"`
+					Title         string `json:"title"`
+					URL           string `json:"url"`
+					LyricsState   string `json:"lyrics_state"`
+					Instrumental  bool   `json:"instrumental"`
+					PrimaryArtist struct {
+						Name string `json:"name"`
+					} `json:"primary_artist"`
+				} `json:"result"`
+			} `json:"hits"`
+		} `json:"response"`
+	}
+	if err := fetchJSONWithHeaders(g.baseURL+"/search?q="+url.QueryEscape(text), headers, &resp); err != nil {
+		return nil, err
+	}
+
+	var tracks []lyricsTrack
+	for _, hit := range resp.Response.Hits {
+		if hit.Type != "song" {
+			continue
+		}
+		r := hit.Result
+		track := lyricsTrack{
+			ID:           strconv.FormatInt(r.ID, 10),
+			Provider:     LyricsProviderGenius,
+			Title:        r.Title,
+			Artist:       r.PrimaryArtist.Name,
+			Instrumental: r.Instrumental,
+			URL:          r.URL,
+		}
+		if r.LyricsState == "complete" && r.URL != "" {
+			pageURL := r.URL
+			track.fetch = func() (lyricsContent, error) {
+				plain, err := fetchGeniusLyrics(pageURL)
+				return lyricsContent{Plain: plain}, err
+			}
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+func fetchGeniusLyrics(pageURL string) (string, error) {
+	doc, err := fetchDDGHTML(pageURL)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	doc.Find(`[data-lyrics-container="true"]`).Each(func(_ int, s *goquery.Selection) {
+		s.Find(`[data-exclude-from-selection="true"]`).Remove()
+		s.Find("br").ReplaceWithHtml("\n")
+		parts = append(parts, strings.TrimSpace(s.Text()))
+	})
+	return strings.TrimSpace(strings.Join(parts, "\n")), nil
+}
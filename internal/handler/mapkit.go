@@ -0,0 +1,605 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "image/jpeg"
+)
+
+const (
+	mapTileSize       = 256
+	mapDefaultWidth   = 800
+	mapDefaultHeight  = 400
+	mapMaxDimension   = 1280
+	mapMaxZoom        = 19
+	mapDefaultZoom    = 15
+	mapFitPadding     = 40
+	mapMaxFeatures    = 50
+	mapMaxPoints      = 2000
+	mapTileFetchLimit = 8
+	mapPinRadius      = 9.5
+)
+
+var mapTileClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// tiles rarely change, so they are cached encoded for a day
+var mapTileCache = newTTLCache[[]byte](24*time.Hour, 2000)
+
+var mapNamedColors = map[string]color.NRGBA{
+	"red":    {0xEA, 0x43, 0x35, 0xFF},
+	"blue":   {0x42, 0x85, 0xF4, 0xFF},
+	"green":  {0x34, 0xA8, 0x53, 0xFF},
+	"yellow": {0xFB, 0xBC, 0x05, 0xFF},
+	"orange": {0xFF, 0x6D, 0x00, 0xFF},
+	"purple": {0x9C, 0x27, 0xB0, 0xFF},
+	"black":  {0x20, 0x21, 0x24, 0xFF},
+	"white":  {0xFF, 0xFF, 0xFF, 0xFF},
+	"gray":   {0x80, 0x86, 0x8B, 0xFF},
+}
+
+type mapPoint struct {
+	Lat, Lon float64
+}
+
+// mapFeature is one markers, path or bbox parameter. They use the google
+// static maps syntax, "color:red|weight:3|lat,lon|lat,lon".
+type mapFeature struct {
+	Kind      string
+	Color     color.NRGBA
+	FillColor color.NRGBA
+	Weight    float64
+	Points    []mapPoint
+}
+
+type staticMap struct {
+	Width, Height int
+	Zoom          int
+	Center        *mapPoint
+	Features      []mapFeature
+}
+
+func mapTileURL() string {
+	if tileURL := os.Getenv("MAPKIT_TILE_URL"); tileURL != "" {
+		return tileURL
+	}
+	return "https://tile.openstreetmap.org/{z}/{x}/{y}.png"
+}
+
+func mapAttribution() string {
+	if attribution := os.Getenv("MAPKIT_ATTRIBUTION"); attribution != "" {
+		return attribution
+	}
+	return "© OpenStreetMap contributors"
+}
+
+// mapkitURL is where the rendered map for a single marker can be fetched.
+// discord loads it without our api key, so it is served through the signed
+// route under PUBLIC_URL. without PUBLIC_URL there is nowhere to point it at
+// and the map is left out.
+func mapkitURL(lat, lon string, zoom int) string {
+	publicURL := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		return ""
+	}
+
+	params := url.Values{}
+	params.Set("center", lat+","+lon)
+	params.Set("zoom", strconv.Itoa(zoom))
+	params.Set("size", fmt.Sprintf("%dx%d", mapDefaultWidth, mapDefaultHeight))
+	params.Set("markers", "color:red|"+lat+","+lon)
+	params.Set("sig", mapkitSignature(params))
+	return publicURL + "/utils/mapkit/image?" + params.Encode()
+}
+
+// mapkitSignature signs the map parameters with the api key, so the public
+// image route only renders maps this server handed out
+func mapkitSignature(params url.Values) string {
+	unsigned := url.Values{}
+	for k, v := range params {
+		if k != "sig" {
+			unsigned[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("API_KEY")))
+	mac.Write([]byte("mapkit:" + unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func parseMapColor(s string) (color.NRGBA, error) {
+	if c, ok := mapNamedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func parseMapPoint(s string) (mapPoint, error) {
+	latStr, lonStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return mapPoint{}, fmt.Errorf("invalid coordinates %q", s)
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return mapPoint{}, fmt.Errorf("invalid coordinates %q", s)
+	}
+	return mapPoint{Lat: lat, Lon: lon}, nil
+}
+
+func parseMapFeature(kind, spec string) (mapFeature, error) {
+	feature := mapFeature{Kind: kind, Color: mapNamedColors["blue"], Weight: 4}
+	if kind == "markers" {
+		feature.Color = mapNamedColors["red"]
+	}
+	fillSet := false
+
+	for _, part := range strings.Split(spec, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			switch strings.ToLower(key) {
+			case "color":
+				c, err := parseMapColor(value)
+				if err != nil {
+					return feature, err
+				}
+				feature.Color = c
+			case "fillcolor":
+				c, err := parseMapColor(value)
+				if err != nil {
+					return feature, err
+				}
+				feature.FillColor = c
+				fillSet = true
+			case "weight":
+				weight, err := strconv.ParseFloat(value, 64)
+				if err != nil || weight <= 0 || weight > 20 {
+					return feature, fmt.Errorf("invalid weight %q", value)
+				}
+				feature.Weight = weight
+			default:
+				return feature, fmt.Errorf("unknown %s style %q", kind, key)
+			}
+			continue
+		}
+
+		p, err := parseMapPoint(part)
+		if err != nil {
+			return feature, err
+		}
+		feature.Points = append(feature.Points, p)
+	}
+
+	if len(feature.Points) == 0 {
+		return feature, fmt.Errorf("%s has no coordinates", kind)
+	}
+	if kind == "path" && len(feature.Points) < 2 {
+		return feature, errors.New("path needs at least two coordinates")
+	}
+	if kind == "bbox" && len(feature.Points) != 2 {
+		return feature, errors.New("bbox needs exactly two corner coordinates")
+	}
+	if kind == "bbox" && !fillSet {
+		feature.FillColor = feature.Color
+		feature.FillColor.A = 0x33
+	}
+	return feature, nil
+}
+
+func parseStaticMap(query url.Values) (*staticMap, error) {
+	m := &staticMap{Width: mapDefaultWidth, Height: mapDefaultHeight, Zoom: -1}
+
+	if size := query.Get("size"); size != "" {
+		wStr, hStr, _ := strings.Cut(strings.ToLower(size), "x")
+		width, err1 := strconv.Atoi(wStr)
+		height, err2 := strconv.Atoi(hStr)
+		if err1 != nil || err2 != nil || width <= 0 || height <= 0 || width > mapMaxDimension || height > mapMaxDimension {
+			return nil, fmt.Errorf("invalid size, expected WIDTHxHEIGHT up to %d", mapMaxDimension)
+		}
+		m.Width, m.Height = width, height
+	}
+
+	if center := query.Get("center"); center != "" {
+		p, err := parseMapPoint(center)
+		if err != nil {
+			return nil, err
+		}
+		m.Center = &p
+	}
+
+	if zoom := query.Get("zoom"); zoom != "" {
+		z, err := strconv.Atoi(zoom)
+		if err != nil || z < 0 || z > mapMaxZoom {
+			return nil, fmt.Errorf("invalid zoom, expected 0 to %d", mapMaxZoom)
+		}
+		m.Zoom = z
+	}
+
+	points := 0
+	for _, kind := range []string{"bbox", "path", "markers"} {
+		for _, spec := range query[kind] {
+			feature, err := parseMapFeature(kind, spec)
+			if err != nil {
+				return nil, err
+			}
+			points += len(feature.Points)
+			m.Features = append(m.Features, feature)
+		}
+	}
+	if len(m.Features) > mapMaxFeatures || points > mapMaxPoints {
+		return nil, errors.New("too many map features")
+	}
+
+	if m.Center == nil && len(m.Features) == 0 {
+		return nil, errors.New("missing 'center' or any markers, path or bbox to show")
+	}
+	return m, nil
+}
+
+// mapWorldPixel projects a coordinate to web mercator pixels at zoom z.
+func mapWorldPixel(p mapPoint, z int) (float64, float64) {
+	scale := float64(mapTileSize) * math.Exp2(float64(z))
+	lat := math.Max(math.Min(p.Lat, 85.05112878), -85.05112878) * math.Pi / 180
+	x := (p.Lon + 180) / 360 * scale
+	y := (1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * scale
+	return x, y
+}
+
+// fitView picks the center and the highest zoom that keeps every feature
+// inside the image, for whatever the request left unset.
+func (m *staticMap) fitView() {
+	if m.Center != nil && m.Zoom >= 0 {
+		return
+	}
+
+	var all []mapPoint
+	for _, f := range m.Features {
+		all = append(all, f.Points...)
+	}
+	if len(all) == 0 {
+		m.Zoom = mapDefaultZoom
+		return
+	}
+
+	minLat, maxLat, minLon, maxLon := all[0].Lat, all[0].Lat, all[0].Lon, all[0].Lon
+	for _, p := range all[1:] {
+		minLat, maxLat = math.Min(minLat, p.Lat), math.Max(maxLat, p.Lat)
+		minLon, maxLon = math.Min(minLon, p.Lon), math.Max(maxLon, p.Lon)
+	}
+	if m.Center == nil {
+		// the center has to be taken in projected space, mercator stretches
+		// latitudes away from the equator
+		x0, y0 := mapWorldPixel(mapPoint{maxLat, minLon}, 0)
+		x1, y1 := mapWorldPixel(mapPoint{minLat, maxLon}, 0)
+		cx, cy := (x0+x1)/2, (y0+y1)/2
+		n := math.Pi - 2*math.Pi*cy/mapTileSize
+		m.Center = &mapPoint{
+			Lat: 180 / math.Pi * math.Atan(math.Sinh(n)),
+			Lon: cx/mapTileSize*360 - 180,
+		}
+	}
+	if m.Zoom >= 0 {
+		return
+	}
+
+	m.Zoom = mapDefaultZoom
+	if minLat == maxLat && minLon == maxLon {
+		return
+	}
+	for z := mapMaxZoom - 2; z >= 0; z-- {
+		x0, y0 := mapWorldPixel(mapPoint{maxLat, minLon}, z)
+		x1, y1 := mapWorldPixel(mapPoint{minLat, maxLon}, z)
+		if x1-x0 <= float64(m.Width-2*mapFitPadding) && y1-y0 <= float64(m.Height-2*mapFitPadding) {
+			m.Zoom = z
+			return
+		}
+	}
+	m.Zoom = 0
+}
+
+func fetchMapTile(z, x, y int) (image.Image, error) {
+	subdomains := []string{"a", "b", "c"}
+	tileURL := strings.NewReplacer(
+		"{z}", strconv.Itoa(z),
+		"{x}", strconv.Itoa(x),
+		"{y}", strconv.Itoa(y),
+		"{s}", subdomains[(x+y)%len(subdomains)],
+	).Replace(mapTileURL())
+
+	data, ok := mapTileCache.get(tileURL)
+	if !ok {
+		// the osm tile usage policy requires an identifying user agent
+		headers := map[string]string{"User-Agent": osmHeaders["User-Agent"]}
+		resp, err := fetchResponse(context.Background(), mapTileClient, tileURL, headers)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 2<<20)); err != nil {
+			return nil, err
+		}
+		mapTileCache.set(tileURL, data)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode tile: %w", err)
+	}
+	return img, nil
+}
+
+// drawTiles fills the canvas with the tiles under it, fetched concurrently.
+// Missing tiles are left blank, only a map without any tile is an error.
+func (m *staticMap) drawTiles(canvas *image.RGBA, originX, originY float64) error {
+	tiles := 1 << m.Zoom
+	minTX, minTY := int(math.Floor(originX/mapTileSize)), int(math.Floor(originY/mapTileSize))
+	maxTX := int(math.Floor((originX + float64(m.Width) - 1) / mapTileSize))
+	maxTY := int(math.Floor((originY + float64(m.Height) - 1) / mapTileSize))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		drawn   int
+		lastErr error
+	)
+	sem := make(chan struct{}, mapTileFetchLimit)
+
+	for ty := minTY; ty <= maxTY; ty++ {
+		if ty < 0 || ty >= tiles {
+			continue
+		}
+		for tx := minTX; tx <= maxTX; tx++ {
+			wg.Add(1)
+			go func(tx, ty int) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				// longitudes wrap around, latitudes don't
+				tile, err := fetchMapTile(m.Zoom, ((tx%tiles)+tiles)%tiles, ty)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					lastErr = err
+					return
+				}
+				dst := image.Pt(int(math.Round(float64(tx*mapTileSize)-originX)), int(math.Round(float64(ty*mapTileSize)-originY)))
+				draw.Draw(canvas, image.Rectangle{Min: dst, Max: dst.Add(image.Pt(mapTileSize, mapTileSize))}, tile, tile.Bounds().Min, draw.Src)
+				drawn++
+			}(tx, ty)
+		}
+	}
+	wg.Wait()
+
+	if drawn == 0 && lastErr != nil {
+		return fmt.Errorf("failed to fetch map tiles: %w", lastErr)
+	}
+	return nil
+}
+
+// paintCoverage raises the mask to the coverage of a shape inside bounds.
+// Coverage is sampled at pixel centers and ramps over one pixel at the
+// edges, which is enough antialiasing for lines and pins.
+func paintCoverage(mask *image.Alpha, bounds image.Rectangle, coverage func(x, y float64) float64) {
+	bounds = bounds.Intersect(mask.Rect)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := coverage(float64(x)+0.5, float64(y)+0.5)
+			if c <= 0 {
+				continue
+			}
+			a := uint8(math.Min(c, 1) * 255)
+			i := mask.PixOffset(x, y)
+			if a > mask.Pix[i] {
+				mask.Pix[i] = a
+			}
+		}
+	}
+}
+
+func edgeCoverage(distance, radius float64) float64 {
+	return radius + 0.5 - distance
+}
+
+func maskCircle(mask *image.Alpha, cx, cy, r float64) {
+	bounds := image.Rect(int(cx-r-1), int(cy-r-1), int(cx+r+2), int(cy+r+2))
+	paintCoverage(mask, bounds, func(x, y float64) float64 {
+		return edgeCoverage(math.Hypot(x-cx, y-cy), r)
+	})
+}
+
+func maskSegment(mask *image.Alpha, x0, y0, x1, y1, width float64) {
+	half := width / 2
+	bounds := image.Rect(
+		int(math.Min(x0, x1)-half-1), int(math.Min(y0, y1)-half-1),
+		int(math.Max(x0, x1)+half+2), int(math.Max(y0, y1)+half+2),
+	)
+	dx, dy := x1-x0, y1-y0
+	lengthSq := dx*dx + dy*dy
+	paintCoverage(mask, bounds, func(x, y float64) float64 {
+		t := 0.0
+		if lengthSq > 0 {
+			t = math.Max(0, math.Min(1, ((x-x0)*dx+(y-y0)*dy)/lengthSq))
+		}
+		return edgeCoverage(math.Hypot(x-(x0+t*dx), y-(y0+t*dy)), half)
+	})
+}
+
+// maskPin draws a map pin whose tip is at x, y: a round head with a
+// triangle below it. grow widens the shape on every side, for outlines.
+func maskPin(mask *image.Alpha, x, y, r, grow float64) {
+	headY := y - r*2.3
+	paintCoverage(mask, pinBounds(x, y, r, grow), func(px, py float64) float64 {
+		if c := edgeCoverage(math.Hypot(px-x, py-headY), r+grow); c > 0 {
+			return c
+		}
+		// the triangle narrows linearly from the head's width to the tip
+		if py < headY || py > y+grow {
+			return 0
+		}
+		halfWidth := r*(y-py)/(y-headY) + grow
+		return edgeCoverage(math.Abs(px-x), halfWidth)
+	})
+}
+
+func pinBounds(x, y, r, grow float64) image.Rectangle {
+	headY := y - r*2.3
+	return image.Rect(int(x-r-grow-2), int(headY-r-grow-2), int(x+r+grow+3), int(y+grow+2))
+}
+
+// compositeMask paints c through the mask, only over the area the mask covers
+func compositeMask(canvas *image.RGBA, mask *image.Alpha, c color.NRGBA) {
+	draw.DrawMask(canvas, mask.Rect, image.NewUniform(c), image.Point{}, mask, mask.Rect.Min, draw.Over)
+}
+
+func (m *staticMap) drawFeatures(canvas *image.RGBA, originX, originY float64) {
+	project := func(p mapPoint) (float64, float64) {
+		x, y := mapWorldPixel(p, m.Zoom)
+		return x - originX, y - originY
+	}
+	newMask := func() *image.Alpha {
+		return image.NewAlpha(canvas.Bounds())
+	}
+
+	for _, f := range m.Features {
+		switch f.Kind {
+		case "bbox":
+			x0, y0 := project(mapPoint{math.Max(f.Points[0].Lat, f.Points[1].Lat), math.Min(f.Points[0].Lon, f.Points[1].Lon)})
+			x1, y1 := project(mapPoint{math.Min(f.Points[0].Lat, f.Points[1].Lat), math.Max(f.Points[0].Lon, f.Points[1].Lon)})
+
+			fill := newMask()
+			paintCoverage(fill, image.Rect(int(x0), int(y0), int(x1)+1, int(y1)+1), func(x, y float64) float64 { return 1 })
+			compositeMask(canvas, fill, f.FillColor)
+
+			outline := newMask()
+			corners := [][2]float64{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}, {x0, y0}}
+			for i := 1; i < len(corners); i++ {
+				maskSegment(outline, corners[i-1][0], corners[i-1][1], corners[i][0], corners[i][1], f.Weight)
+			}
+			compositeMask(canvas, outline, f.Color)
+
+		case "path":
+			line := newMask()
+			px, py := project(f.Points[0])
+			for _, p := range f.Points[1:] {
+				x, y := project(p)
+				maskSegment(line, px, py, x, y, f.Weight)
+				px, py = x, y
+			}
+			compositeMask(canvas, line, f.Color)
+
+		case "markers":
+			// pins get masks of their own size, a full canvas per pin adds up
+			// quickly with thousands of markers
+			for _, p := range f.Points {
+				x, y := project(p)
+				bounds := pinBounds(x, y, mapPinRadius, 1.5).Intersect(canvas.Bounds())
+				if bounds.Empty() {
+					continue
+				}
+				outline, fill, dot := image.NewAlpha(bounds), image.NewAlpha(bounds), image.NewAlpha(bounds)
+				maskPin(outline, x, y, mapPinRadius, 1.5)
+				maskPin(fill, x, y, mapPinRadius, 0)
+				maskCircle(dot, x, y-mapPinRadius*2.3, 3.5)
+				compositeMask(canvas, outline, color.NRGBA{0, 0, 0, 0x80})
+				compositeMask(canvas, fill, f.Color)
+				compositeMask(canvas, dot, color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF})
+			}
+		}
+	}
+}
+
+func (m *staticMap) render() ([]byte, error) {
+	m.fitView()
+
+	cx, cy := mapWorldPixel(*m.Center, m.Zoom)
+	originX, originY := cx-float64(m.Width)/2, cy-float64(m.Height)/2
+
+	canvas := image.NewRGBA(image.Rect(0, 0, m.Width, m.Height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.NRGBA{0xE5, 0xE3, 0xDF, 0xFF}), image.Point{}, draw.Src)
+
+	if err := m.drawTiles(canvas, originX, originY); err != nil {
+		return nil, err
+	}
+	m.drawFeatures(canvas, originX, originY)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, fmt.Errorf("failed to encode map: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func GetMapKit(w http.ResponseWriter, r *http.Request) {
+	serveStaticMap(w, r.URL.Query())
+}
+
+// GetSignedMapKit is the unauthenticated route for the map urls embedded in
+// responses, it needs the signature mapkitURL adds
+func GetSignedMapKit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(mapkitSignature(query))) {
+		rw := newResponseWriter(w, time.Now())
+		rw.writeError(StatusError, "invalid signature")
+		return
+	}
+	query.Del("sig")
+	serveStaticMap(w, query)
+}
+
+func serveStaticMap(w http.ResponseWriter, query url.Values) {
+	rw := newResponseWriter(w, time.Now())
+
+	m, err := parseStaticMap(query)
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	data, err := m.render()
+	if err != nil {
+		rw.writeError(StatusError, "failed to render map")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Header().Set("X-Map-Attribution", mapAttribution())
+	w.Write(data)
+}
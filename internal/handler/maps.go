@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	nearbyDefaultRadius  = 500
+	nearbyMaxRadius      = 2000
+	nearbyPerCategoryMax = 10
+)
+
+var errPlaceNotFound = errors.New("place not found")
+
+// nominatim and overpass both ask for an identifying user agent
+var osmHeaders = map[string]string{
+	"User-Agent": "MeteorDiscordBot/1.0 (https://github.com/meteor-discord/backend)",
+}
+
+type nominatimPlace struct {
+	PlaceID     int64             `json:"place_id"`
+	OsmType     string            `json:"osm_type"`
+	OsmID       int64             `json:"osm_id"`
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	Category    string            `json:"category"`
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	ExtraTags   map[string]string `json:"extratags"`
+}
+
+// osmID formats an element as nominatim's lookup expects it, e.g. "N240109189".
+func osmID(osmType string, id int64) string {
+	if osmType == "" {
+		return ""
+	}
+	return strings.ToUpper(osmType[:1]) + strconv.FormatInt(id, 10)
+}
+
+// parseOSMID accepts "N123", "node/123" and the way and relation forms.
+func parseOSMID(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if kind, id, ok := strings.Cut(s, "/"); ok {
+		if kind != "node" && kind != "way" && kind != "relation" {
+			return "", false
+		}
+		s = kind[:1] + id
+	}
+	if len(s) < 2 || !strings.ContainsRune("NWRnwr", rune(s[0])) {
+		return "", false
+	}
+	if _, err := strconv.ParseInt(s[1:], 10, 64); err != nil {
+		return "", false
+	}
+	return strings.ToUpper(s[:1]) + s[1:], true
+}
+
+func nominatimURL(endpoint string, params url.Values) string {
+	params.Set("format", "jsonv2")
+	params.Set("extratags", "1")
+	return "https://nominatim.openstreetmap.org/" + endpoint + "?" + params.Encode()
+}
+
+func lookupOSMPlace(id string) (*nominatimPlace, error) {
+	var places []nominatimPlace
+	if err := fetchJSONWithHeaders(nominatimURL("lookup", url.Values{"osm_ids": {id}}), osmHeaders, &places); err != nil {
+		return nil, err
+	}
+	if len(places) == 0 {
+		return nil, errPlaceNotFound
+	}
+	return &places[0], nil
+}
+
+// resolvePlace finds the place a supplemental request is about, by osm id,
+// by the nominatim place_id SearchMaps returns, or by coordinates.
+func resolvePlace(query url.Values) (*nominatimPlace, error) {
+	if raw := query.Get("osm_id"); raw != "" {
+		id, ok := parseOSMID(raw)
+		if !ok {
+			return nil, errors.New("invalid 'osm_id' query parameter")
+		}
+		return lookupOSMPlace(id)
+	}
+
+	if placeID := query.Get("place_id"); placeID != "" {
+		// details is the only endpoint taking a place_id, it tells us the osm
+		// element which lookup then returns in the usual format
+		var details struct {
+			OsmType string `json:"osm_type"`
+			OsmID   int64  `json:"osm_id"`
+		}
+		detailsURL := "https://nominatim.openstreetmap.org/details?format=json&place_id=" + url.QueryEscape(placeID)
+		if err := fetchJSONWithHeaders(detailsURL, osmHeaders, &details); err != nil {
+			if isNotFoundError(err) {
+				return nil, errPlaceNotFound
+			}
+			return nil, err
+		}
+		if details.OsmType == "" {
+			return nil, errPlaceNotFound
+		}
+		return lookupOSMPlace(osmID(details.OsmType, details.OsmID))
+	}
+
+	lat, lon := query.Get("lat"), query.Get("lon")
+	if lat == "" || lon == "" {
+		return nil, errors.New("missing 'place_id', 'osm_id' or 'lat' and 'lon' query parameters")
+	}
+	if _, err := parseMapPoint(lat + "," + lon); err != nil {
+		return nil, err
+	}
+
+	var place nominatimPlace
+	if err := fetchJSONWithHeaders(nominatimURL("reverse", url.Values{"lat": {lat}, "lon": {lon}}), osmHeaders, &place); err != nil {
+		return nil, err
+	}
+	if place.OsmType == "" {
+		return nil, errPlaceNotFound
+	}
+	return &place, nil
+}
+
+func firstTag(tags map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := tags[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func buildPlaceDetails(tags map[string]string) map[string]interface{} {
+	details := map[string]interface{}{}
+	fields := map[string][]string{
+		"opening_hours": {"opening_hours"},
+		"phone":         {"phone", "contact:phone"},
+		"website":       {"website", "contact:website", "url"},
+		"email":         {"email", "contact:email"},
+		"wikidata":      {"wikidata"},
+		"wikipedia":     {"wikipedia"},
+		"cuisine":       {"cuisine"},
+		"wheelchair":    {"wheelchair"},
+		"operator":      {"operator"},
+		"brand":         {"brand"},
+	}
+	for field, keys := range fields {
+		if v := firstTag(tags, keys...); v != "" {
+			details[field] = v
+		}
+	}
+	return details
+}
+
+type wikipediaSummary struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Summary     string `json:"summary"`
+	URL         string `json:"url"`
+	Thumbnail   string `json:"thumbnail,omitempty"`
+}
+
+// fetchWikipediaSummary resolves the wikipedia tag ("en:Berlin"), or the
+// english article linked from the wikidata item when there is none.
+func fetchWikipediaSummary(wikipediaTag, wikidataID string) (*wikipediaSummary, error) {
+	lang, title, ok := strings.Cut(wikipediaTag, ":")
+	if !ok && wikidataID != "" {
+		var entity struct {
+			Entities map[string]struct {
+				Sitelinks map[string]struct {
+					Title string `json:"title"`
+				} `json:"sitelinks"`
+			} `json:"entities"`
+		}
+		entityURL := fmt.Sprintf("https://www.wikidata.org/wiki/Special:EntityData/%s.json", url.PathEscape(wikidataID))
+		if err := fetchJSONWithHeaders(entityURL, wikimediaHeaders, &entity); err != nil {
+			return nil, err
+		}
+		lang, title = "en", entity.Entities[wikidataID].Sitelinks["enwiki"].Title
+	}
+	if title == "" {
+		return nil, errors.New("no linked wikipedia article")
+	}
+
+	var page struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Extract     string `json:"extract"`
+		Thumbnail   struct {
+			Source string `json:"source"`
+		} `json:"thumbnail"`
+		ContentURLs struct {
+			Desktop struct {
+				Page string `json:"page"`
+			} `json:"desktop"`
+		} `json:"content_urls"`
+	}
+	summaryURL := fmt.Sprintf("https://%s.wikipedia.org/api/rest_v1/page/summary/%s", url.PathEscape(lang), url.PathEscape(strings.ReplaceAll(title, " ", "_")))
+	if err := fetchJSONWithHeaders(summaryURL, wikimediaHeaders, &page); err != nil {
+		return nil, err
+	}
+
+	return &wikipediaSummary{
+		Title:       page.Title,
+		Description: page.Description,
+		Summary:     page.Extract,
+		URL:         page.ContentURLs.Desktop.Page,
+		Thumbnail:   page.Thumbnail.Source,
+	}, nil
+}
+
+type overpassElement struct {
+	Type   string  `json:"type"`
+	ID     int64   `json:"id"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Center *struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"center"`
+	Tags map[string]string `json:"tags"`
+}
+
+var poiAmenityCategories = map[string]string{
+	"restaurant": "food", "cafe": "food", "fast_food": "food", "bar": "food", "pub": "food",
+	"ice_cream": "food", "food_court": "food", "biergarten": "food",
+	"bus_station": "transport", "parking": "transport", "fuel": "transport", "bicycle_rental": "transport",
+	"charging_station": "transport", "taxi": "transport", "ferry_terminal": "transport",
+	"pharmacy": "health", "hospital": "health", "clinic": "health", "doctors": "health", "dentist": "health",
+	"school": "education", "university": "education", "college": "education", "library": "education", "kindergarten": "education",
+	"bank": "finance", "atm": "finance", "bureau_de_change": "finance",
+	"post_office": "services", "police": "services", "townhall": "services", "fire_station": "services",
+	"cinema": "entertainment", "theatre": "entertainment", "nightclub": "entertainment", "arts_centre": "entertainment",
+	"place_of_worship": "worship",
+}
+
+func poiCategory(tags map[string]string) (string, string) {
+	switch {
+	case tags["amenity"] != "":
+		if category, ok := poiAmenityCategories[tags["amenity"]]; ok {
+			return category, tags["amenity"]
+		}
+		return "other", tags["amenity"]
+	case tags["shop"] != "":
+		return "shopping", tags["shop"]
+	case tags["tourism"] != "":
+		return "tourism", tags["tourism"]
+	case tags["leisure"] != "":
+		return "leisure", tags["leisure"]
+	case tags["railway"] != "" || tags["public_transport"] != "":
+		return "transport", firstTag(tags, "railway", "public_transport")
+	}
+	return "other", ""
+}
+
+// distanceMeters is the great circle distance between two coordinates.
+func distanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371000
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := toRad(lat2-lat1), toRad(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func fetchNearbyPOIs(lat, lon float64, radius int, exclude string) (map[string][]map[string]interface{}, error) {
+	endpoint := os.Getenv("OVERPASS_URL")
+	if endpoint == "" {
+		endpoint = "https://overpass-api.de/api/interpreter"
+	}
+
+	around := fmt.Sprintf("(around:%d,%f,%f)", radius, lat, lon)
+	query := fmt.Sprintf(`[out:json][timeout:15];(nwr%[1]s[amenity][name];nwr%[1]s[shop][name];nwr%[1]s[tourism][name];nwr%[1]s[leisure][name];nwr%[1]s[railway=station][name];nwr%[1]s[public_transport=station][name];);out center 200;`, around)
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(url.Values{"data": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range osmHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := ddgClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusCodeError{code: resp.StatusCode}
+	}
+
+	var result struct {
+		Elements []overpassElement `json:"elements"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	type poi struct {
+		category string
+		distance float64
+		data     map[string]interface{}
+	}
+	var pois []poi
+	for _, e := range result.Elements {
+		id := osmID(e.Type, e.ID)
+		if id == exclude || e.Tags["name"] == "" {
+			continue
+		}
+		pLat, pLon := e.Lat, e.Lon
+		if e.Center != nil {
+			pLat, pLon = e.Center.Lat, e.Center.Lon
+		}
+
+		category, kind := poiCategory(e.Tags)
+		distance := distanceMeters(lat, lon, pLat, pLon)
+		data := map[string]interface{}{
+			"name":     e.Tags["name"],
+			"type":     kind,
+			"osm_id":   id,
+			"distance": math.Round(distance),
+			"lat":      pLat,
+			"lon":      pLon,
+		}
+		if hours := e.Tags["opening_hours"]; hours != "" {
+			data["opening_hours"] = hours
+		}
+		pois = append(pois, poi{category: category, distance: distance, data: data})
+	}
+
+	sort.Slice(pois, func(i, j int) bool {
+		return pois[i].distance < pois[j].distance
+	})
+
+	grouped := map[string][]map[string]interface{}{}
+	for _, p := range pois {
+		if len(grouped[p.category]) < nearbyPerCategoryMax {
+			grouped[p.category] = append(grouped[p.category], p.data)
+		}
+	}
+	return grouped, nil
+}
+
+func SearchMapsSupplemental(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	radius := nearbyDefaultRadius
+	if v := query.Get("radius"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeSearchJSONError(w, StatusError, "invalid 'radius' query parameter")
+			return
+		}
+		radius = min(n, nearbyMaxRadius)
+	}
+
+	place, err := resolvePlace(query)
+	if errors.Is(err, errPlaceNotFound) {
+		writeSearchJSONError(w, StatusNotFound, "place not found")
+		return
+	}
+	if err != nil {
+		writeSearchJSONError(w, StatusError, err.Error())
+		return
+	}
+
+	lat, _ := strconv.ParseFloat(place.Lat, 64)
+	lon, _ := strconv.ParseFloat(place.Lon, 64)
+	id := osmID(place.OsmType, place.OsmID)
+
+	name := place.Name
+	if name == "" {
+		name = place.DisplayName
+	}
+
+	response := map[string]interface{}{
+		"status": StatusSuccess,
+		"place": map[string]interface{}{
+			"name":         name,
+			"address":      place.DisplayName,
+			"place_id":     place.PlaceID,
+			"osm_id":       id,
+			"category":     place.Category,
+			"display_type": place.Type,
+			"coordinates": map[string]interface{}{
+				"lat": place.Lat,
+				"lon": place.Lon,
+			},
+			"url": fmt.Sprintf("https://www.openstreetmap.org/%s/%d", place.OsmType, place.OsmID),
+		},
+		"details": buildPlaceDetails(place.ExtraTags),
+	}
+
+	// both of these are extras, the place details are still worth returning
+	// when wikipedia or overpass are unavailable
+	if summary, err := fetchWikipediaSummary(place.ExtraTags["wikipedia"], place.ExtraTags["wikidata"]); err == nil {
+		response["wikipedia"] = summary
+	}
+	if nearby, err := fetchNearbyPOIs(lat, lon, radius, id); err == nil {
+		response["nearby"] = nearby
+	}
+
+	writeSearchJSON(w, response)
+}
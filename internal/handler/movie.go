@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MovieTypeMovie  = "movie"
+	MovieTypeTV     = "tv"
+	MovieTypePerson = "person"
+)
+
+const (
+	movieMaxResults = 5
+	movieCastLimit  = 5
+)
+
+var errMovieProviderNotConfigured = errors.New("movie provider not configured")
+
+// MovieProvider looks up movies, tv shows and people by free-text query.
+type MovieProvider interface {
+	Search(query, mediaType, region string) ([]map[string]interface{}, error)
+}
+
+func newMovieProvider() (MovieProvider, error) {
+	apiKey := os.Getenv("TMDB_API_KEY")
+	if apiKey == "" {
+		return nil, errMovieProviderNotConfigured
+	}
+	return &tmdbProvider{apiKey: apiKey, baseURL: "https://api.themoviedb.org/3"}, nil
+}
+
+const (
+	tmdbPosterBase   = "https://image.tmdb.org/t/p/w500"
+	tmdbBackdropBase = "https://image.tmdb.org/t/p/w1280"
+	tmdbProfileBase  = "https://image.tmdb.org/t/p/w185"
+	tmdbLogoBase     = "https://image.tmdb.org/t/p/w92"
+)
+
+type tmdbProvider struct {
+	apiKey  string
+	baseURL string
+}
+
+type tmdbSearchResult struct {
+	ID                 int     `json:"id"`
+	Name               string  `json:"name"`
+	KnownForDepartment string  `json:"known_for_department"`
+	ProfilePath        string  `json:"profile_path"`
+	Popularity         float64 `json:"popularity"`
+	KnownFor           []struct {
+		MediaType    string `json:"media_type"`
+		Title        string `json:"title"`
+		Name         string `json:"name"`
+		ReleaseDate  string `json:"release_date"`
+		FirstAirDate string `json:"first_air_date"`
+	} `json:"known_for"`
+}
+
+type tmdbSearchResponse struct {
+	Results []tmdbSearchResult `json:"results"`
+}
+
+type tmdbProviderEntry struct {
+	ProviderName string `json:"provider_name"`
+	LogoPath     string `json:"logo_path"`
+}
+
+type tmdbDetails struct {
+	ID               int     `json:"id"`
+	Title            string  `json:"title"`
+	Name             string  `json:"name"`
+	Overview         string  `json:"overview"`
+	ReleaseDate      string  `json:"release_date"`
+	FirstAirDate     string  `json:"first_air_date"`
+	PosterPath       string  `json:"poster_path"`
+	BackdropPath     string  `json:"backdrop_path"`
+	Runtime          int     `json:"runtime"`
+	EpisodeRunTime   []int   `json:"episode_run_time"`
+	NumberOfSeasons  int     `json:"number_of_seasons"`
+	NumberOfEpisodes int     `json:"number_of_episodes"`
+	VoteAverage      float64 `json:"vote_average"`
+	VoteCount        int     `json:"vote_count"`
+	Genres           []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	Credits struct {
+		Cast []struct {
+			Name        string `json:"name"`
+			Character   string `json:"character"`
+			ProfilePath string `json:"profile_path"`
+		} `json:"cast"`
+	} `json:"credits"`
+	WatchProviders struct {
+		Results map[string]struct {
+			Link     string              `json:"link"`
+			Flatrate []tmdbProviderEntry `json:"flatrate"`
+			Rent     []tmdbProviderEntry `json:"rent"`
+			Buy      []tmdbProviderEntry `json:"buy"`
+		} `json:"results"`
+	} `json:"watch/providers"`
+}
+
+func (p *tmdbProvider) endpoint(path string, params url.Values) string {
+	params.Set("api_key", p.apiKey)
+	return fmt.Sprintf("%s%s?%s", p.baseURL, path, params.Encode())
+}
+
+func (p *tmdbProvider) Search(query, mediaType, region string) ([]map[string]interface{}, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("include_adult", "false")
+
+	var search tmdbSearchResponse
+	if err := fetchJSON(p.endpoint("/search/"+mediaType, params), &search); err != nil {
+		return nil, err
+	}
+
+	hits := search.Results
+	if len(hits) > movieMaxResults {
+		hits = hits[:movieMaxResults]
+	}
+
+	if mediaType == MovieTypePerson {
+		results := make([]map[string]interface{}, 0, len(hits))
+		for _, hit := range hits {
+			results = append(results, buildTMDBPerson(hit))
+		}
+		return results, nil
+	}
+
+	results := make([]map[string]interface{}, len(hits))
+	var wg sync.WaitGroup
+	for i, hit := range hits {
+		wg.Add(1)
+		go func(i, id int) {
+			defer wg.Done()
+
+			var details tmdbDetails
+			detailParams := url.Values{}
+			detailParams.Set("append_to_response", "credits,watch/providers")
+			if err := fetchJSON(p.endpoint(fmt.Sprintf("/%s/%d", mediaType, id), detailParams), &details); err != nil {
+				return
+			}
+			results[i] = buildTMDBTitle(details, mediaType, region)
+		}(i, hit.ID)
+	}
+	wg.Wait()
+
+	filtered := results[:0]
+	for _, result := range results {
+		if result != nil {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+func tmdbImage(base, path string) string {
+	if path == "" {
+		return ""
+	}
+	return base + path
+}
+
+func tmdbYear(date string) string {
+	if len(date) >= 4 {
+		return date[:4]
+	}
+	return ""
+}
+
+func buildTMDBTitle(d tmdbDetails, mediaType, region string) map[string]interface{} {
+	title := d.Title
+	date := d.ReleaseDate
+	runtime := d.Runtime
+	if mediaType == MovieTypeTV {
+		title = d.Name
+		date = d.FirstAirDate
+		if len(d.EpisodeRunTime) > 0 {
+			runtime = d.EpisodeRunTime[0]
+		}
+	}
+
+	genres := make([]string, 0, len(d.Genres))
+	for _, g := range d.Genres {
+		genres = append(genres, g.Name)
+	}
+
+	cast := make([]map[string]interface{}, 0, movieCastLimit)
+	for i, c := range d.Credits.Cast {
+		if i >= movieCastLimit {
+			break
+		}
+		cast = append(cast, map[string]interface{}{
+			"name":      c.Name,
+			"character": c.Character,
+			"image":     tmdbImage(tmdbProfileBase, c.ProfilePath),
+		})
+	}
+
+	result := map[string]interface{}{
+		"id":       d.ID,
+		"type":     mediaType,
+		"title":    title,
+		"year":     tmdbYear(date),
+		"date":     date,
+		"overview": d.Overview,
+		"url":      fmt.Sprintf("https://www.themoviedb.org/%s/%d", mediaType, d.ID),
+		"images": map[string]interface{}{
+			"poster":   tmdbImage(tmdbPosterBase, d.PosterPath),
+			"backdrop": tmdbImage(tmdbBackdropBase, d.BackdropPath),
+		},
+		"runtime": runtime,
+		"genres":  genres,
+		"rating": map[string]interface{}{
+			"score": d.VoteAverage,
+			"votes": d.VoteCount,
+		},
+		"cast":      cast,
+		"providers": buildTMDBProviders(d, region),
+	}
+
+	if mediaType == MovieTypeTV {
+		result["seasons"] = d.NumberOfSeasons
+		result["episodes"] = d.NumberOfEpisodes
+	}
+
+	return result
+}
+
+func buildTMDBProviders(d tmdbDetails, region string) map[string]interface{} {
+	entry, ok := d.WatchProviders.Results[region]
+	if !ok {
+		return nil
+	}
+
+	convert := func(entries []tmdbProviderEntry) []map[string]interface{} {
+		out := make([]map[string]interface{}, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, map[string]interface{}{
+				"name": e.ProviderName,
+				"logo": tmdbImage(tmdbLogoBase, e.LogoPath),
+			})
+		}
+		return out
+	}
+
+	return map[string]interface{}{
+		"region": region,
+		"link":   entry.Link,
+		"stream": convert(entry.Flatrate),
+		"rent":   convert(entry.Rent),
+		"buy":    convert(entry.Buy),
+	}
+}
+
+func buildTMDBPerson(p tmdbSearchResult) map[string]interface{} {
+	knownFor := make([]map[string]interface{}, 0, len(p.KnownFor))
+	for _, k := range p.KnownFor {
+		title := k.Title
+		date := k.ReleaseDate
+		if k.MediaType == MovieTypeTV {
+			title = k.Name
+			date = k.FirstAirDate
+		}
+		knownFor = append(knownFor, map[string]interface{}{
+			"type":  k.MediaType,
+			"title": title,
+			"year":  tmdbYear(date),
+		})
+	}
+
+	return map[string]interface{}{
+		"id":         p.ID,
+		"type":       MovieTypePerson,
+		"name":       p.Name,
+		"department": p.KnownForDepartment,
+		"url":        fmt.Sprintf("https://www.themoviedb.org/person/%d", p.ID),
+		"images": map[string]interface{}{
+			"profile": tmdbImage(tmdbPosterBase, p.ProfilePath),
+		},
+		"popularity": p.Popularity,
+		"known_for":  knownFor,
+	}
+}
+
+func SearchMovie(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	mediaType := strings.ToLower(r.URL.Query().Get("type"))
+	if mediaType == "" {
+		mediaType = MovieTypeMovie
+	}
+	if mediaType != MovieTypeMovie && mediaType != MovieTypeTV && mediaType != MovieTypePerson {
+		rw.writeError(StatusError, "invalid 'type' query parameter, expected movie, tv or person")
+		return
+	}
+
+	region := strings.ToUpper(r.URL.Query().Get("region"))
+	if region == "" {
+		region = "US"
+	}
+
+	provider, err := newMovieProvider()
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	results, err := provider.Search(query, mediaType, region)
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch movie results")
+		return
+	}
+
+	if len(results) == 0 {
+		rw.writeError(StatusNotFound, "no results found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"results": results,
+	})
+}
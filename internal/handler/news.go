@@ -0,0 +1,599 @@
+package handler
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	newsTimeout           = 15 * time.Second
+	newsMaxCards          = 15
+	newsMaxCollectionSize = 5
+	newsFeedMaxBytes      = 5 << 20
+)
+
+var newsCache = newTTLCache[[]newsItem](5*time.Minute, 200)
+
+type newsQuery struct {
+	Query    string
+	Region   string
+	Language string
+	// Since is zero when there is no recency filter
+	Since time.Time
+	When  string
+}
+
+type newsItem struct {
+	Title       string
+	URL         string
+	Description string
+	Publisher   string
+	// PublisherURL is used to pick the favicon, the article url may be a
+	// redirect through the aggregator
+	PublisherURL string
+	Author       string
+	Image        string
+	Published    time.Time
+}
+
+// newsProvider is a source of news articles, either a search api or a set of
+// feeds filtered locally.
+type newsProvider interface {
+	name() string
+	fetch(ctx context.Context, q newsQuery) ([]newsItem, error)
+}
+
+func newsProviders() []newsProvider {
+	names := os.Getenv("NEWS_PROVIDERS")
+	if names == "" {
+		names = "google,feeds"
+	}
+
+	var providers []newsProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "google":
+			providers = append(providers, &googleNewsProvider{})
+		case "feeds":
+			var feeds []string
+			for _, feed := range strings.Split(os.Getenv("NEWS_FEEDS"), ",") {
+				if feed = strings.TrimSpace(feed); feed != "" {
+					feeds = append(feeds, feed)
+				}
+			}
+			if len(feeds) > 0 {
+				providers = append(providers, &feedNewsProvider{feeds: feeds})
+			}
+		}
+	}
+	return providers
+}
+
+type feedMedia struct {
+	URL    string `xml:"url,attr"`
+	Medium string `xml:"medium,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Source      struct {
+		Name string `xml:",chardata"`
+		URL  string `xml:"url,attr"`
+	} `xml:"source"`
+	MediaContent   []feedMedia `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaThumbnail []feedMedia `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Enclosures     []feedMedia `xml:"enclosure"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Author    struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	MediaThumbnail []feedMedia `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaContent   []feedMedia `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+// feedDocument decodes both rss 2.0 (<rss><channel>) and atom (<feed>)
+// documents, only the matching fields get filled.
+type feedDocument struct {
+	Channel struct {
+		Title string `xml:"title"`
+		// atom:link elements share the local name, they carry no text
+		Links    []string  `xml:"link"`
+		Language string    `xml:"language"`
+		Items    []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Title   string      `xml:"title"`
+	Lang    string      `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+var feedTimeLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC822Z, time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05", "2006-01-02",
+}
+
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func feedImage(groups ...[]feedMedia) string {
+	for _, media := range groups {
+		for _, m := range media {
+			if m.URL == "" {
+				continue
+			}
+			if m.Medium == "image" || strings.HasPrefix(m.Type, "image/") || (m.Medium == "" && m.Type == "") {
+				return m.URL
+			}
+		}
+	}
+	return ""
+}
+
+func cleanFeedText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(stripHTML(s))), " ")
+}
+
+// fetchFeed downloads and parses a feed. It returns the feed's language,
+// which is empty when the feed doesn't declare one.
+func fetchFeed(ctx context.Context, feedURL string) ([]newsItem, string, error) {
+	headers := map[string]string{
+		"User-Agent": getDDGHeaders()["User-Agent"],
+		"Accept":     "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8",
+	}
+	resp, err := fetchResponse(ctx, ddgClient, feedURL, headers)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var doc feedDocument
+	decoder := xml.NewDecoder(io.LimitReader(resp.Body, newsFeedMaxBytes))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("decode failed: %w", err)
+	}
+
+	var items []newsItem
+	for _, it := range doc.Channel.Items {
+		item := newsItem{
+			Title:        cleanFeedText(it.Title),
+			URL:          strings.TrimSpace(it.Link),
+			Description:  cleanFeedText(it.Description),
+			Publisher:    strings.TrimSpace(it.Source.Name),
+			PublisherURL: it.Source.URL,
+			Author:       it.Creator,
+			Image:        feedImage(it.MediaContent, it.MediaThumbnail, it.Enclosures),
+			Published:    parseFeedTime(it.PubDate),
+		}
+		if item.Published.IsZero() {
+			item.Published = parseFeedTime(it.Date)
+		}
+		if item.Publisher == "" {
+			item.Publisher = cleanFeedText(doc.Channel.Title)
+			for _, link := range doc.Channel.Links {
+				if link = strings.TrimSpace(link); link != "" {
+					item.PublisherURL = link
+					break
+				}
+			}
+		}
+		items = append(items, item)
+	}
+
+	for _, e := range doc.Entries {
+		item := newsItem{
+			Title:       cleanFeedText(e.Title),
+			Description: cleanFeedText(e.Summary),
+			Publisher:   cleanFeedText(doc.Title),
+			Author:      e.Author.Name,
+			Image:       feedImage(e.MediaThumbnail, e.MediaContent),
+			Published:   parseFeedTime(e.Published),
+		}
+		for _, link := range e.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				item.URL = link.Href
+				break
+			}
+		}
+		if item.Description == "" {
+			item.Description = truncateText(cleanFeedText(e.Content), 300)
+		}
+		if item.Published.IsZero() {
+			item.Published = parseFeedTime(e.Updated)
+		}
+		items = append(items, item)
+	}
+
+	lang := doc.Channel.Language
+	if lang == "" {
+		lang = doc.Lang
+	}
+	return items, strings.ToLower(lang), nil
+}
+
+type googleNewsProvider struct{}
+
+func (g *googleNewsProvider) name() string {
+	return "google"
+}
+
+func (g *googleNewsProvider) fetch(ctx context.Context, q newsQuery) ([]newsItem, error) {
+	region := strings.ToUpper(q.Region)
+	if region == "" {
+		region = "US"
+	}
+	lang := q.Language
+	if lang == "" {
+		lang = "en"
+	}
+	params := url.Values{}
+	params.Set("hl", lang+"-"+region)
+	params.Set("gl", region)
+	params.Set("ceid", region+":"+lang)
+
+	feedURL := "https://news.google.com/rss?" + params.Encode()
+	if q.Query != "" {
+		search := q.Query
+		if q.When != "" {
+			search += " when:" + q.When
+		}
+		params.Set("q", search)
+		feedURL = "https://news.google.com/rss/search?" + params.Encode()
+	}
+
+	items, _, err := fetchFeed(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		// titles end in " - Publisher" and the description only repeats the
+		// title with links to related coverage
+		items[i].Title = strings.TrimSuffix(items[i].Title, " - "+items[i].Publisher)
+		items[i].Description = ""
+	}
+	return items, nil
+}
+
+// feedNewsProvider reads the configured rss and atom feeds and keeps the
+// items matching every word of the query.
+type feedNewsProvider struct {
+	feeds []string
+}
+
+func (f *feedNewsProvider) name() string {
+	return "feeds"
+}
+
+func (f *feedNewsProvider) fetch(ctx context.Context, q newsQuery) ([]newsItem, error) {
+	terms := strings.Fields(strings.ToLower(q.Query))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		matched []newsItem
+		lastErr error
+		ok      int
+	)
+	for _, feedURL := range f.feeds {
+		wg.Add(1)
+		go func(feedURL string) {
+			defer wg.Done()
+			items, lang, err := fetchFeed(ctx, feedURL)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				return
+			}
+			ok++
+			if q.Language != "" && lang != "" && !strings.HasPrefix(lang, strings.ToLower(q.Language)) {
+				return
+			}
+			for _, item := range items {
+				text := strings.ToLower(item.Title + " " + item.Description)
+				matches := true
+				for _, term := range terms {
+					if !strings.Contains(text, term) {
+						matches = false
+						break
+					}
+				}
+				if matches {
+					matched = append(matched, item)
+				}
+			}
+		}(feedURL)
+	}
+	wg.Wait()
+
+	if ok == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return matched, nil
+}
+
+var newsRecencyPattern = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+// parseNewsRecency reads "when" values like google news uses them, 12h, 3d
+// or 2w.
+func parseNewsRecency(when string) (time.Duration, error) {
+	m := newsRecencyPattern.FindStringSubmatch(strings.ToLower(when))
+	if m == nil {
+		return 0, errors.New("invalid 'when' query parameter, expected e.g. 12h, 7d or 2w")
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{"h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+	return time.Duration(n) * unit, nil
+}
+
+var newsStopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "that": true, "this": true, "are": true,
+	"was": true, "has": true, "have": true, "its": true, "into": true, "over": true, "after": true, "about": true,
+	"says": true, "said": true, "new": true, "how": true, "why": true, "what": true, "who": true, "will": true,
+	"his": true, "her": true, "they": true, "their": true, "more": true, "than": true, "out": true, "but": true,
+}
+
+var newsWordSplitter = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func newsTitleTokens(title string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, word := range newsWordSplitter.Split(strings.ToLower(title), -1) {
+		if len(word) >= 3 && !newsStopwords[word] {
+			tokens[word] = true
+		}
+	}
+	return tokens
+}
+
+// sameStory treats two headlines as the same story when at least three
+// significant words are shared and they make up half of the shorter title.
+func sameStory(a, b map[string]bool) bool {
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return shared >= 3 && float64(shared) >= 0.5*float64(min(len(a), len(b)))
+}
+
+// clusterNews groups items covering the same story, keeping the order of
+// the input so the first item of every cluster is its newest.
+func clusterNews(items []newsItem) [][]newsItem {
+	var clusters [][]newsItem
+	var tokens [][]map[string]bool
+	for _, item := range items {
+		itemTokens := newsTitleTokens(item.Title)
+		placed := false
+		for i := range clusters {
+			for _, memberTokens := range tokens[i] {
+				if sameStory(itemTokens, memberTokens) {
+					clusters[i] = append(clusters[i], item)
+					tokens[i] = append(tokens[i], itemTokens)
+					placed = true
+					break
+				}
+			}
+			if placed {
+				break
+			}
+		}
+		if !placed {
+			clusters = append(clusters, []newsItem{item})
+			tokens = append(tokens, []map[string]bool{itemTokens})
+		}
+	}
+	return clusters
+}
+
+func newsPublisherHost(item newsItem) string {
+	for _, raw := range []string{item.PublisherURL, item.URL} {
+		if u, err := url.Parse(raw); err == nil && u.Host != "" && !strings.HasSuffix(u.Host, "news.google.com") {
+			return strings.TrimPrefix(u.Host, "www.")
+		}
+	}
+	return ""
+}
+
+func buildNewsArticleCard(item newsItem) map[string]interface{} {
+	card := map[string]interface{}{
+		"type":  NewsCardTypeArticle,
+		"title": item.Title,
+		"url":   item.URL,
+		"publisher": map[string]interface{}{
+			"name": item.Publisher,
+			"icon": fmt.Sprintf("https://www.google.com/s2/favicons?domain=%s&sz=64", newsPublisherHost(item)),
+		},
+		"description": item.Description,
+	}
+	if item.Author != "" {
+		card["author"] = item.Author
+	}
+	if item.Image != "" {
+		card["image"] = item.Image
+	}
+	if !item.Published.IsZero() {
+		card["timestamp"] = item.Published.UnixMilli()
+	}
+	return card
+}
+
+func buildNewsCards(items []newsItem) []map[string]interface{} {
+	var cards []map[string]interface{}
+	for _, cluster := range clusterNews(items) {
+		if len(cards) >= newsMaxCards {
+			break
+		}
+		if len(cluster) == 1 {
+			cards = append(cards, buildNewsArticleCard(cluster[0]))
+			continue
+		}
+
+		articles := make([]map[string]interface{}, 0, newsMaxCollectionSize)
+		for i := 0; i < len(cluster) && i < newsMaxCollectionSize; i++ {
+			articles = append(articles, buildNewsArticleCard(cluster[i]))
+		}
+		card := map[string]interface{}{
+			"type":     NewsCardTypeCollection,
+			"title":    cluster[0].Title,
+			"articles": articles,
+		}
+		if !cluster[0].Published.IsZero() {
+			card["timestamp"] = cluster[0].Published.UnixMilli()
+		}
+		cards = append(cards, card)
+	}
+	return cards
+}
+
+// searchNews queries every provider concurrently, then merges, dedupes and
+// sorts the results newest first.
+func searchNews(ctx context.Context, q newsQuery) ([]newsItem, error) {
+	cacheKey := strings.Join([]string{q.Query, q.Region, q.Language, q.When}, "\x00")
+	if cached, ok := newsCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	providers := newsProviders()
+	if len(providers) == 0 {
+		return nil, errors.New("no news providers configured")
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		all     []newsItem
+		lastErr error
+		ok      int
+	)
+	for _, p := range providers {
+		wg.Add(1)
+		go func(p newsProvider) {
+			defer wg.Done()
+			items, err := p.fetch(ctx, q)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = fmt.Errorf("%s: %w", p.name(), err)
+				return
+			}
+			ok++
+			all = append(all, items...)
+		}(p)
+	}
+	wg.Wait()
+
+	if ok == 0 {
+		return nil, lastErr
+	}
+
+	seen := map[string]bool{}
+	var items []newsItem
+	for _, item := range all {
+		key := strings.ToLower(item.Title)
+		if item.Title == "" || item.URL == "" || seen[key] || seen[item.URL] {
+			continue
+		}
+		if !q.Since.IsZero() && !item.Published.IsZero() && item.Published.Before(q.Since) {
+			continue
+		}
+		seen[key], seen[item.URL] = true, true
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Published.After(items[j].Published)
+	})
+
+	// a partial merge would hide the failed provider's results until the
+	// entry expires
+	if ok == len(providers) {
+		newsCache.set(cacheKey, items)
+	}
+	return items, nil
+}
+
+func SearchNews(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	q := newsQuery{
+		Query:    strings.TrimSpace(query.Get("q")),
+		Region:   query.Get("region"),
+		Language: strings.ToLower(query.Get("lang")),
+		When:     strings.ToLower(query.Get("when")),
+	}
+	if q.When != "" {
+		recency, err := parseNewsRecency(q.When)
+		if err != nil {
+			writeSearchJSONError(w, StatusError, err.Error())
+			return
+		}
+		q.Since = time.Now().Add(-recency)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), newsTimeout)
+	defer cancel()
+
+	items, err := searchNews(ctx, q)
+	if err != nil {
+		writeSearchJSONError(w, StatusError, "failed to fetch news results")
+		return
+	}
+
+	if len(items) == 0 {
+		writeSearchJSONError(w, StatusNotFound, "no news results found")
+		return
+	}
+
+	cards := buildNewsCards(items)
+	resolveNewsCardURLs(r.Context(), cards)
+
+	writeSearchJSON(w, map[string]interface{}{
+		"status": StatusSuccess,
+		"cards":  cards,
+	})
+}
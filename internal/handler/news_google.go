@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	googleNewsResolveTimeout = 5 * time.Second
+	googleNewsResolveWorkers = 8
+)
+
+// google news article ids never change, so resolved urls are kept for long
+var googleNewsURLCache = newTTLCache[string](24*time.Hour, 5000)
+
+var errGoogleNewsDecode = errors.New("unexpected google news response")
+
+// googleNewsArticleID returns the article id of a news.google.com article
+// link, the rss items link to /rss/articles/<id>
+func googleNewsArticleID(articleURL string) (string, bool) {
+	u, err := url.Parse(articleURL)
+	if err != nil || u.Host != "news.google.com" {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] != "articles" || parts[len(parts)-1] == "" {
+		return "", false
+	}
+	return parts[len(parts)-1], true
+}
+
+// resolveGoogleNewsURL turns a google news article link into the publisher's
+// url. The link itself only serves a page redirecting with javascript, the
+// target comes from the batchexecute rpc that page calls, signed with values
+// embedded in the page.
+func resolveGoogleNewsURL(ctx context.Context, articleURL string) (string, error) {
+	id, ok := googleNewsArticleID(articleURL)
+	if !ok {
+		return articleURL, nil
+	}
+	if cached, ok := googleNewsURLCache.get(id); ok {
+		return cached, nil
+	}
+
+	resp, err := fetchResponse(ctx, ddgClient, "https://news.google.com/rss/articles/"+id, getDDGHeaders())
+	if err != nil {
+		return "", err
+	}
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("parse failed: %w", err)
+	}
+	params := doc.Find("[data-n-a-sg][data-n-a-ts]").First()
+	signature, _ := params.Attr("data-n-a-sg")
+	timestamp, _ := params.Attr("data-n-a-ts")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); signature == "" || err != nil {
+		return "", errGoogleNewsDecode
+	}
+
+	request := fmt.Sprintf(
+		`["garturlreq",[["X","X",["X","X"],null,null,1,1,"US:en",null,1,null,null,null,null,null,0,1],"X","X",1,[1,1,1],1,1,null,0,0,null,0],%q,%s,%q]`,
+		id, timestamp, signature,
+	)
+	payload, err := json.Marshal([][][]interface{}{{{"Fbv4je", request, nil, "generic"}}})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://news.google.com/_/DotsSplashUi/data/batchexecute",
+		strings.NewReader(url.Values{"f.req": {string(payload)}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	req.Header.Set("User-Agent", getDDGHeaders()["User-Agent"])
+
+	resp, err = ddgClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &statusCodeError{code: resp.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	// the body is an anti-xssi prefix and a blank line, then the rpc results
+	// as [["wrb.fr","Fbv4je","<json>",...],...]
+	_, rest, ok := strings.Cut(string(body), "\n\n")
+	if !ok {
+		return "", errGoogleNewsDecode
+	}
+	var envelope [][]interface{}
+	if err := json.NewDecoder(strings.NewReader(rest)).Decode(&envelope); err != nil {
+		return "", fmt.Errorf("decode failed: %w", err)
+	}
+	if len(envelope) == 0 || len(envelope[0]) < 3 {
+		return "", errGoogleNewsDecode
+	}
+	inner, _ := envelope[0][2].(string)
+	var result []interface{}
+	if err := json.Unmarshal([]byte(inner), &result); err != nil {
+		return "", fmt.Errorf("decode failed: %w", err)
+	}
+	if len(result) < 2 {
+		return "", errGoogleNewsDecode
+	}
+	resolved, _ := result[1].(string)
+	if !strings.HasPrefix(resolved, "http://") && !strings.HasPrefix(resolved, "https://") {
+		return "", errGoogleNewsDecode
+	}
+
+	googleNewsURLCache.set(id, resolved)
+	return resolved, nil
+}
+
+// resolveNewsCardURLs replaces the google news links of the article cards,
+// including those inside collections, with the publisher urls. Links that
+// fail to resolve are kept, they still work in a browser.
+func resolveNewsCardURLs(ctx context.Context, cards []map[string]interface{}) {
+	var articles []map[string]interface{}
+	for _, card := range cards {
+		if nested, ok := card["articles"].([]map[string]interface{}); ok {
+			articles = append(articles, nested...)
+			continue
+		}
+		articles = append(articles, card)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, googleNewsResolveTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, googleNewsResolveWorkers)
+	for _, article := range articles {
+		articleURL, _ := article["url"].(string)
+		if _, ok := googleNewsArticleID(articleURL); !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(article map[string]interface{}, articleURL string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if resolved, err := resolveGoogleNewsURL(ctx, articleURL); err == nil {
+				article["url"] = resolved
+			}
+		}(article, articleURL)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,398 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	perspectiveTimeout      = 15 * time.Second
+	perspectiveMaxTextChars = 3000
+)
+
+const (
+	ToxicityAttributeToxicity       = "toxicity"
+	ToxicityAttributeInsult         = "insult"
+	ToxicityAttributeThreat         = "threat"
+	ToxicityAttributeProfanity      = "profanity"
+	ToxicityAttributeIdentityAttack = "identity_attack"
+)
+
+// perspectiveAttributes maps our attribute names to the ones used by the
+// Perspective API.
+var perspectiveAttributes = map[string]string{
+	ToxicityAttributeToxicity:       "TOXICITY",
+	ToxicityAttributeInsult:         "INSULT",
+	ToxicityAttributeThreat:         "THREAT",
+	ToxicityAttributeProfanity:      "PROFANITY",
+	ToxicityAttributeIdentityAttack: "IDENTITY_ATTACK",
+}
+
+// toxicityScorer rates text between 0 and 1 for every toxicity attribute.
+type toxicityScorer interface {
+	name() string
+	score(ctx context.Context, text, lang string) (map[string]float64, error)
+}
+
+type perspectiveScorer struct {
+	apiKey string
+}
+
+func (p *perspectiveScorer) name() string {
+	return "perspective"
+}
+
+func (p *perspectiveScorer) score(ctx context.Context, text, lang string) (map[string]float64, error) {
+	requested := map[string]interface{}{}
+	for _, attr := range perspectiveAttributes {
+		requested[attr] = map[string]interface{}{}
+	}
+	body := map[string]interface{}{
+		"comment":             map[string]string{"text": text},
+		"requestedAttributes": requested,
+		"doNotStore":          true,
+	}
+	if lang != "" {
+		body["languages"] = []string{lang}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	apiURL := "https://commentanalyzer.googleapis.com/v1alpha1/comments:analyze?key=" + url.QueryEscape(p.apiKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusCodeError{code: resp.StatusCode}
+	}
+
+	var result struct {
+		AttributeScores map[string]struct {
+			SummaryScore struct {
+				Value float64 `json:"value"`
+			} `json:"summaryScore"`
+		} `json:"attributeScores"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	scores := map[string]float64{}
+	for ours, theirs := range perspectiveAttributes {
+		scores[ours] = result.AttributeScores[theirs].SummaryScore.Value
+	}
+	return scores, nil
+}
+
+// lexiconScorer is a local approximation of Perspective: weighted word lists
+// per attribute plus a few patterns for threats, attacks on groups and
+// insults aimed at the reader. It is only meant to keep moderation features
+// working without an api key.
+type lexiconScorer struct{}
+
+type lexiconTerm struct {
+	attribute string
+	weight    float64
+	// prefix terms also match longer words, "idiot*" matches "idiots". stems
+	// that start harmless words ("stab" in "stable") list their forms instead.
+	prefix bool
+}
+
+var (
+	toxicityLexicon = map[string]lexiconTerm{}
+	// toxicityPrefixStems are the prefix terms longest first, so overlapping
+	// stems like "fuck" and "motherfuck" always resolve the same way
+	toxicityPrefixStems []string
+)
+
+var toxicityLexiconSource = []struct {
+	attribute string
+	weight    float64
+	terms     []string
+}{
+	{ToxicityAttributeProfanity, 0.9, []string{"fuck*", "motherfuck*", "cunt*", "shit", "shits", "shitty", "shitting", "shithead", "shitheads", "shithole", "shitholes", "bullshit", "asshole*", "bitch*", "wank*", "twat*"}},
+	{ToxicityAttributeProfanity, 0.6, []string{"bastard*", "dick", "dickhead*", "prick", "pricks", "piss*", "bollocks", "arse", "ass", "cock", "jackass"}},
+	{ToxicityAttributeProfanity, 0.3, []string{"damn*", "crap*", "hell", "bloody", "sucks", "screw"}},
+	{ToxicityAttributeInsult, 0.85, []string{"retard*", "dumbass*", "scum*", "worthless", "subhuman", "degenerate*"}},
+	{ToxicityAttributeInsult, 0.65, []string{"idiot*", "moron*", "imbecile*", "stupid*", "loser*", "pathetic", "disgusting", "ugly", "dumb", "trash", "garbage", "clown*", "freak*", "creep", "creeps", "creepy", "jerk", "jerks"}},
+	{ToxicityAttributeInsult, 0.35, []string{"lame", "noob*", "annoying", "useless", "fool", "fools", "foolish", "weirdo*", "cringe*"}},
+	{ToxicityAttributeThreat, 0.5, []string{"kill", "kills", "killed", "killing", "murder*", "stab", "stabs", "stabbed", "stabbing", "shoot", "shoots", "shooting", "strangle*", "kys"}},
+}
+
+var toxicityIdentityTerms = map[string]bool{
+	"gay": true, "gays": true, "lesbian": true, "lesbians": true, "trans": true, "transgender": true, "queer": true,
+	"jew": true, "jews": true, "jewish": true, "muslim": true, "muslims": true, "islam": true, "christian": true, "christians": true,
+	"black": true, "blacks": true, "white": true, "whites": true, "asian": true, "asians": true, "mexican": true, "mexicans": true,
+	"immigrant": true, "immigrants": true, "refugee": true, "refugees": true, "women": true, "woman": true, "girls": true,
+	"men": true, "disabled": true, "autistic": true, "hindu": true, "hindus": true, "arab": true, "arabs": true,
+}
+
+var (
+	threatPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\b(i('ll| will)|i'm (gonna|going to)|im (gonna|going to)|gonna|we('ll| will))\s+(kill|hurt|murder|stab|shoot|beat|strangle|find|end)\s+(you|u|ya|him|her|them)\b`),
+		regexp.MustCompile(`\b(kill|hang|shoot)\s+(yo)?urself\b`),
+		regexp.MustCompile(`\byou('re| are|r)\s+(dead|gonna die|going to die)\b`),
+		regexp.MustCompile(`\bi know where (you|u) live\b`),
+		regexp.MustCompile(`\b(watch|sleep with one eye open|better watch) your back\b`),
+	}
+	identityHatePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\b(hate|despise)\s+(all\s+)?(the\s+)?\w+`),
+		regexp.MustCompile(`\bshould\s+(all\s+)?(die|be (killed|deported|gassed|exterminated|banned))\b`),
+		regexp.MustCompile(`\bare\s+(all\s+)?(animals|vermin|subhuman|inferior|disgusting|trash|parasites|rats|a disease)\b`),
+		regexp.MustCompile(`\bgo back to\b`),
+	}
+	secondPersonPattern = regexp.MustCompile(`\b(you|u|ur|your|you're|youre|ya)\b`)
+)
+
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+
+var lexiconOnce sync.Once
+
+// loadToxicityLexicon builds the term table, adding entries from the tab
+// separated "attribute term weight" file in PERSPECTIVE_LEXICON if set.
+func loadToxicityLexicon() {
+	lexiconOnce.Do(func() {
+		add := func(attribute, term string, weight float64) {
+			prefix := strings.HasSuffix(term, "*")
+			toxicityLexicon[strings.TrimSuffix(term, "*")] = lexiconTerm{attribute: attribute, weight: weight, prefix: prefix}
+		}
+		for _, group := range toxicityLexiconSource {
+			for _, term := range group.terms {
+				add(group.attribute, term, group.weight)
+			}
+		}
+		if path := os.Getenv("PERSPECTIVE_LEXICON"); path != "" {
+			readLexiconFile(path, add)
+		}
+
+		for stem, term := range toxicityLexicon {
+			if term.prefix {
+				toxicityPrefixStems = append(toxicityPrefixStems, stem)
+			}
+		}
+		sort.Slice(toxicityPrefixStems, func(i, j int) bool {
+			a, b := toxicityPrefixStems[i], toxicityPrefixStems[j]
+			if len(a) != len(b) {
+				return len(a) > len(b)
+			}
+			return a < b
+		})
+	})
+}
+
+func readLexiconFile(path string, add func(attribute, term string, weight float64)) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("failed to open toxicity lexicon: %v", err)
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, ok := perspectiveAttributes[fields[0]]; !ok {
+			continue
+		}
+		weight, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		add(fields[0], strings.ToLower(fields[1]), math.Min(math.Max(weight, 0), 1))
+	}
+}
+
+// collapseRepeats shortens runs of three or more of the same letter, so
+// stretched words like "stuuupid" still match.
+func collapseRepeats(word string) (string, bool) {
+	var b strings.Builder
+	runes := []rune(word)
+	collapsed := false
+	for i := 0; i < len(runes); i++ {
+		j := i
+		for j+1 < len(runes) && runes[j+1] == runes[i] {
+			j++
+		}
+		if j-i >= 2 {
+			collapsed = true
+		}
+		b.WriteRune(runes[i])
+		i = j
+	}
+	return b.String(), collapsed
+}
+
+func lookupLexiconTerm(word string) (lexiconTerm, bool) {
+	if term, ok := toxicityLexicon[word]; ok {
+		return term, true
+	}
+	for _, stem := range toxicityPrefixStems {
+		if len(word) > len(stem) && strings.HasPrefix(word, stem) {
+			return toxicityLexicon[stem], true
+		}
+	}
+	return lexiconTerm{}, false
+}
+
+// combineScores treats every signal as an independent chance of the text
+// being toxic, so repeated hits approach but never reach 1.
+func combineScores(scores ...float64) float64 {
+	remaining := 1.0
+	for _, s := range scores {
+		remaining *= 1 - s
+	}
+	return 1 - remaining
+}
+
+func (l *lexiconScorer) name() string {
+	return "local"
+}
+
+func (l *lexiconScorer) score(ctx context.Context, text, lang string) (map[string]float64, error) {
+	loadToxicityLexicon()
+
+	lower := strings.ToLower(text)
+	hits := map[string][]float64{}
+	identityMentioned := false
+
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '@' && r != '$' && r != '\''
+	})
+	for _, raw := range words {
+		word := strings.Trim(leetReplacer.Replace(raw), "'")
+		if toxicityIdentityTerms[word] {
+			identityMentioned = true
+		}
+
+		term, ok := lookupLexiconTerm(word)
+		if !ok {
+			if collapsed, changed := collapseRepeats(word); changed {
+				term, ok = lookupLexiconTerm(collapsed)
+			}
+		}
+		if ok {
+			hits[term.attribute] = append(hits[term.attribute], term.weight)
+		}
+	}
+
+	scores := map[string]float64{}
+	for attribute := range perspectiveAttributes {
+		scores[attribute] = combineScores(hits[attribute]...)
+	}
+
+	// single violent words are weak evidence, a threat aimed at someone is not
+	for _, pattern := range threatPatterns {
+		if pattern.MatchString(lower) {
+			scores[ToxicityAttributeThreat] = combineScores(scores[ToxicityAttributeThreat], 0.85)
+		}
+	}
+
+	if secondPersonPattern.MatchString(lower) && (scores[ToxicityAttributeInsult] > 0 || scores[ToxicityAttributeProfanity] > 0.5) {
+		scores[ToxicityAttributeInsult] = combineScores(scores[ToxicityAttributeInsult], 0.3)
+	}
+
+	if identityMentioned {
+		for _, pattern := range identityHatePatterns {
+			if pattern.MatchString(lower) {
+				scores[ToxicityAttributeIdentityAttack] = combineScores(scores[ToxicityAttributeIdentityAttack], 0.6)
+			}
+		}
+		if scores[ToxicityAttributeInsult] > 0 {
+			scores[ToxicityAttributeIdentityAttack] = combineScores(scores[ToxicityAttributeIdentityAttack], scores[ToxicityAttributeInsult]*0.5)
+		}
+	}
+
+	shouting := 0.0
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= 8 && float64(upper)/float64(letters) > 0.7 {
+		shouting = 0.15
+	}
+
+	scores[ToxicityAttributeToxicity] = combineScores(
+		scores[ToxicityAttributeToxicity],
+		math.Max(scores[ToxicityAttributeInsult], math.Max(scores[ToxicityAttributeThreat], scores[ToxicityAttributeIdentityAttack])),
+		scores[ToxicityAttributeProfanity]*0.7,
+		shouting,
+	)
+
+	for attribute, value := range scores {
+		scores[attribute] = math.Round(value*10000) / 10000
+	}
+	return scores, nil
+}
+
+func GetPerspective(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	text := strings.TrimSpace(r.URL.Query().Get("text"))
+	if text == "" {
+		rw.writeError(StatusError, "missing 'text' query parameter")
+		return
+	}
+	if len([]rune(text)) > perspectiveMaxTextChars {
+		rw.writeError(StatusError, fmt.Sprintf("text is longer than %d characters", perspectiveMaxTextChars))
+		return
+	}
+	lang := strings.ToLower(r.URL.Query().Get("lang"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), perspectiveTimeout)
+	defer cancel()
+
+	var scorer toxicityScorer = &lexiconScorer{}
+	if key := os.Getenv("PERSPECTIVE_API_KEY"); key != "" {
+		scorer = &perspectiveScorer{apiKey: key}
+	}
+
+	scores, err := scorer.score(ctx, text, lang)
+	if err != nil {
+		// the local scorer can't fail, so moderation keeps working when
+		// the api is down or over quota
+		log.Printf("perspective api failed, using local scorer: %v", err)
+		scorer = &lexiconScorer{}
+		scores, _ = scorer.score(ctx, text, lang)
+	}
+
+	rw.write(map[string]interface{}{
+		"status":   StatusSuccess,
+		"provider": scorer.name(),
+		"scores":   scores,
+	})
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	quoraMaxResults    = 10
+	quoraMaxAnswers    = 5
+	quoraAnswerMaxLen  = 1000
+	quoraSnippetMaxLen = 300
+)
+
+var quoraAnswerCountPattern = regexp.MustCompile(`(?i)(\d[\d,.]*\s*[km]?)\s+answers?`)
+
+func isQuoraURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return host == "quora.com" || strings.HasSuffix(host, ".quora.com")
+}
+
+func truncateText(s string, maxLen int) string {
+	runes := []rune(strings.TrimSpace(s))
+	if len(runes) <= maxLen {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:maxLen])) + "…"
+}
+
+func SearchQuora(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s&kp=1", url.QueryEscape("site:quora.com "+query))
+
+	doc, err := fetchDDGHTML(searchURL)
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch quora results")
+		return
+	}
+
+	var results []map[string]interface{}
+	doc.Find("div.result, div.results_links").Each(func(i int, s *goquery.Selection) {
+		if len(results) >= quoraMaxResults {
+			return
+		}
+
+		link := s.Find("a.result__a").First()
+		href, exists := link.Attr("href")
+		if !exists || href == "" {
+			return
+		}
+
+		if strings.Contains(href, "duckduckgo.com/l/") {
+			if u, err := url.Parse(href); err == nil {
+				if uddg := u.Query().Get("uddg"); uddg != "" {
+					href = uddg
+				}
+			}
+		}
+
+		// profile, space and topic pages also live on quora.com, only
+		// question pages are useful here
+		if !isQuoraURL(href) || strings.Contains(href, "/profile/") || strings.Contains(href, "/topic/") {
+			return
+		}
+
+		title := strings.TrimSpace(link.Text())
+		title = strings.TrimSuffix(title, " - Quora")
+		if title == "" {
+			return
+		}
+
+		snippet := strings.TrimSpace(s.Find("a.result__snippet").First().Text())
+
+		result := map[string]interface{}{
+			"title":   title,
+			"url":     href,
+			"snippet": truncateText(snippet, quoraSnippetMaxLen),
+		}
+		if m := quoraAnswerCountPattern.FindStringSubmatch(snippet); m != nil {
+			result["answers"] = strings.TrimSpace(m[1])
+		}
+
+		results = append(results, result)
+	})
+
+	if len(results) == 0 {
+		rw.writeError(StatusNotFound, "no results found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"results": results,
+	})
+}
+
+type quoraAnswer struct {
+	Text        string          `json:"text"`
+	UpvoteCount int             `json:"upvoteCount"`
+	DateCreated string          `json:"dateCreated"`
+	URL         string          `json:"url"`
+	Author      json.RawMessage `json:"author"`
+}
+
+type quoraQAPage struct {
+	Type       string `json:"@type"`
+	MainEntity struct {
+		Name            string        `json:"name"`
+		Text            string        `json:"text"`
+		AnswerCount     int           `json:"answerCount"`
+		AcceptedAnswer  *quoraAnswer  `json:"acceptedAnswer"`
+		SuggestedAnswer []quoraAnswer `json:"suggestedAnswer"`
+	} `json:"mainEntity"`
+}
+
+// quoraAuthorName handles schema.org authors given either as a single
+// object or a list of them.
+func quoraAuthorName(raw json.RawMessage) string {
+	type person struct {
+		Name string `json:"name"`
+	}
+
+	var single person
+	if err := json.Unmarshal(raw, &single); err == nil && single.Name != "" {
+		return single.Name
+	}
+
+	var list []person
+	if err := json.Unmarshal(raw, &list); err == nil && len(list) > 0 {
+		return list[0].Name
+	}
+	return ""
+}
+
+// parseQuoraPage reads the schema.org QAPage that quora embeds as json-ld,
+// which is far more stable than its generated class names.
+func parseQuoraPage(doc *goquery.Document) (*quoraQAPage, bool) {
+	var page *quoraQAPage
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		var candidate quoraQAPage
+		if err := json.Unmarshal([]byte(s.Text()), &candidate); err != nil {
+			return true
+		}
+		if candidate.Type == "QAPage" && candidate.MainEntity.Name != "" {
+			page = &candidate
+			return false
+		}
+		return true
+	})
+	return page, page != nil
+}
+
+func buildQuoraAnswer(a quoraAnswer) map[string]interface{} {
+	return map[string]interface{}{
+		"author":  quoraAuthorName(a.Author),
+		"upvotes": a.UpvoteCount,
+		"date":    a.DateCreated,
+		"url":     a.URL,
+		"text":    truncateText(html.UnescapeString(stripHTML(a.Text)), quoraAnswerMaxLen),
+	}
+}
+
+func SearchQuoraResult(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	pageURL := r.URL.Query().Get("url")
+	if pageURL == "" {
+		rw.writeError(StatusError, "missing 'url' query parameter")
+		return
+	}
+
+	if !isQuoraURL(pageURL) {
+		rw.writeError(StatusError, "url is not a quora page")
+		return
+	}
+
+	var page *quoraQAPage
+	doc, err := fetchDDGHTML(pageURL)
+	if err == nil {
+		page, _ = parseQuoraPage(doc)
+	}
+
+	// quora often serves a login wall or a script-only shell to plain
+	// requests, the browser gets the real page
+	if page == nil {
+		rendered, err := fetchRenderedHTML(pageURL)
+		if err != nil {
+			rw.writeError(StatusError, "failed to fetch quora page")
+			return
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(rendered))
+		if err != nil {
+			rw.writeError(StatusError, "failed to parse quora page")
+			return
+		}
+		page, _ = parseQuoraPage(doc)
+	}
+
+	if page == nil {
+		rw.writeError(StatusNotFound, "question not found")
+		return
+	}
+
+	var answers []map[string]interface{}
+	if page.MainEntity.AcceptedAnswer != nil {
+		answers = append(answers, buildQuoraAnswer(*page.MainEntity.AcceptedAnswer))
+	}
+	for _, a := range page.MainEntity.SuggestedAnswer {
+		if len(answers) >= quoraMaxAnswers {
+			break
+		}
+		answers = append(answers, buildQuoraAnswer(a))
+	}
+
+	rw.write(map[string]interface{}{
+		"status": StatusSuccess,
+		"question": map[string]interface{}{
+			"title":   page.MainEntity.Name,
+			"text":    truncateText(html.UnescapeString(stripHTML(page.MainEntity.Text)), quoraAnswerMaxLen),
+			"url":     pageURL,
+			"answers": page.MainEntity.AnswerCount,
+		},
+		"answers": answers,
+	})
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	reverseImageMaxBytes      = 10 << 20
+	reverseImageMaxPixels     = 25_000_000
+	reverseImageMaxMatches    = 10
+	reverseImageMinSimilarity = 0.8
+)
+
+type reverseImageMatch struct {
+	Similarity float64  `json:"similarity"`
+	Title      string   `json:"title"`
+	Author     string   `json:"author,omitempty"`
+	Source     string   `json:"source"`
+	Thumbnail  string   `json:"thumbnail,omitempty"`
+	Links      []string `json:"links"`
+	Backend    string   `json:"backend"`
+}
+
+// reverseImageBackend looks up an image by url or by its perceptual hashes.
+type reverseImageBackend interface {
+	name() string
+	search(imageURL string, hashes *imageHashes) ([]reverseImageMatch, error)
+}
+
+func reverseImageBackends() []reverseImageBackend {
+	var backends []reverseImageBackend
+	if key := os.Getenv("SAUCENAO_API_KEY"); key != "" {
+		backends = append(backends, &sauceNAOBackend{apiKey: key})
+	}
+	if path := os.Getenv("REVERSE_IMAGE_INDEX"); path != "" {
+		backends = append(backends, &hashIndexBackend{path: path})
+	}
+	return backends
+}
+
+func reverseImageEngineLinks(imageURL string) map[string]string {
+	escaped := url.QueryEscape(imageURL)
+	return map[string]string{
+		"google_lens": "https://lens.google.com/uploadbyurl?url=" + escaped,
+		"yandex":      "https://yandex.com/images/search?rpt=imageview&url=" + escaped,
+		"bing":        "https://www.bing.com/images/search?view=detailv2&iss=sbi&form=SBIVSP&sbisrc=UrlPaste&q=imgurl:" + escaped,
+		"tineye":      "https://tineye.com/search?url=" + escaped,
+	}
+}
+
+func fetchImage(imageURL string) (image.Image, error) {
+	resp, err := fetchResponse(context.Background(), httpClient, imageURL, map[string]string{"User-Agent": "MeteorDiscordBot/1.0"})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, reverseImageMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	// a small file can still declare a huge canvas, check before allocating it
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > reverseImageMaxPixels {
+		return nil, fmt.Errorf("image is too large: %dx%d", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+type sauceNAOBackend struct {
+	apiKey string
+}
+
+type sauceNAOResponse struct {
+	Results []struct {
+		Header struct {
+			Similarity string `json:"similarity"`
+			Thumbnail  string `json:"thumbnail"`
+			IndexName  string `json:"index_name"`
+		} `json:"header"`
+		Data struct {
+			ExtURLs    []string `json:"ext_urls"`
+			Title      string   `json:"title"`
+			Source     string   `json:"source"`
+			AuthorName string   `json:"author_name"`
+			MemberName string   `json:"member_name"`
+			Creator    any      `json:"creator"`
+		} `json:"data"`
+	} `json:"results"`
+}
+
+func (s *sauceNAOBackend) name() string {
+	return "saucenao"
+}
+
+func (s *sauceNAOBackend) search(imageURL string, _ *imageHashes) ([]reverseImageMatch, error) {
+	apiURL := fmt.Sprintf(
+		"https://saucenao.com/search.php?output_type=2&numres=%d&api_key=%s&url=%s",
+		reverseImageMaxMatches, url.QueryEscape(s.apiKey), url.QueryEscape(imageURL),
+	)
+
+	var resp sauceNAOResponse
+	if err := fetchJSON(apiURL, &resp); err != nil {
+		return nil, err
+	}
+
+	matches := make([]reverseImageMatch, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		similarity, err := strconv.ParseFloat(result.Header.Similarity, 64)
+		if err != nil {
+			continue
+		}
+
+		author := result.Data.AuthorName
+		if author == "" {
+			author = result.Data.MemberName
+		}
+		if author == "" {
+			if creator, ok := result.Data.Creator.(string); ok {
+				author = creator
+			}
+		}
+
+		title := result.Data.Title
+		if title == "" {
+			title = result.Header.IndexName
+		}
+
+		links := result.Data.ExtURLs
+		source := result.Data.Source
+		if source == "" && len(links) > 0 {
+			source = links[0]
+		}
+
+		matches = append(matches, reverseImageMatch{
+			Similarity: similarity / 100,
+			Title:      title,
+			Author:     author,
+			Source:     source,
+			Thumbnail:  result.Header.Thumbnail,
+			Links:      links,
+			Backend:    s.name(),
+		})
+	}
+	return matches, nil
+}
+
+// hashIndexBackend matches against a local json file of known images, each
+// entry holding a hex encoded phash alongside its metadata.
+type hashIndexBackend struct {
+	path string
+}
+
+type hashIndexEntry struct {
+	Hash      string   `json:"hash"`
+	Title     string   `json:"title"`
+	Author    string   `json:"author"`
+	Source    string   `json:"source"`
+	Thumbnail string   `json:"thumbnail"`
+	Links     []string `json:"links"`
+
+	hash uint64
+}
+
+var (
+	hashIndexOnce    sync.Once
+	hashIndexEntries []hashIndexEntry
+)
+
+func loadHashIndex(path string) []hashIndexEntry {
+	hashIndexOnce.Do(func() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("failed to read reverse image index: %v", err)
+			return
+		}
+
+		var entries []hashIndexEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.Printf("failed to parse reverse image index: %v", err)
+			return
+		}
+
+		for _, entry := range entries {
+			hash, err := parseImageHash(entry.Hash)
+			if err != nil {
+				continue
+			}
+			entry.hash = hash
+			hashIndexEntries = append(hashIndexEntries, entry)
+		}
+	})
+	return hashIndexEntries
+}
+
+func (h *hashIndexBackend) name() string {
+	return "index"
+}
+
+func (h *hashIndexBackend) search(_ string, hashes *imageHashes) ([]reverseImageMatch, error) {
+	if hashes == nil {
+		return nil, nil
+	}
+
+	var matches []reverseImageMatch
+	for _, entry := range loadHashIndex(h.path) {
+		similarity := hashSimilarity(hashes.Perceptual, entry.hash)
+		if similarity < reverseImageMinSimilarity {
+			continue
+		}
+		matches = append(matches, reverseImageMatch{
+			Similarity: similarity,
+			Title:      entry.Title,
+			Author:     entry.Author,
+			Source:     entry.Source,
+			Thumbnail:  entry.Thumbnail,
+			Links:      entry.Links,
+			Backend:    h.name(),
+		})
+	}
+	return matches, nil
+}
+
+func SearchReverseImage(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	imageURL := r.URL.Query().Get("url")
+	if imageURL == "" {
+		rw.writeError(StatusError, "missing 'url' query parameter")
+		return
+	}
+
+	parsed, err := url.Parse(imageURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		rw.writeError(StatusError, "invalid URL format")
+		return
+	}
+
+	// hashing is best effort, formats the standard library cannot decode
+	// can still be looked up by url
+	var hashes *imageHashes
+	if img, err := fetchImage(imageURL); err == nil {
+		h := computeImageHashes(img)
+		hashes = &h
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		matches []reverseImageMatch
+	)
+	for _, backend := range reverseImageBackends() {
+		wg.Add(1)
+		go func(b reverseImageBackend) {
+			defer wg.Done()
+			found, err := b.search(imageURL, hashes)
+			if err != nil {
+				log.Printf("reverse image backend %s failed: %v", b.name(), err)
+				return
+			}
+			mu.Lock()
+			matches = append(matches, found...)
+			mu.Unlock()
+		}(backend)
+	}
+	wg.Wait()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+	if len(matches) > reverseImageMaxMatches {
+		matches = matches[:reverseImageMaxMatches]
+	}
+	if matches == nil {
+		matches = []reverseImageMatch{}
+	}
+
+	response := map[string]interface{}{
+		"status":  StatusSuccess,
+		"matches": matches,
+		"engines": reverseImageEngineLinks(imageURL),
+	}
+	if hashes != nil {
+		response["hashes"] = hashes.hex()
+	}
+
+	rw.write(response)
+}
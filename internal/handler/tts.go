@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	AudioFormatOgg = "ogg"
+	AudioFormatMP3 = "mp3"
+	AudioFormatWAV = "wav"
+)
+
+const (
+	ttsTimeout      = 60 * time.Second
+	ttsMaxTextChars = 1000
+)
+
+var errTTSNotConfigured = errors.New("tts engine not configured")
+
+var audioContentTypes = map[string]string{
+	AudioFormatOgg: "audio/ogg",
+	AudioFormatMP3: "audio/mpeg",
+	AudioFormatWAV: "audio/wav",
+}
+
+type ttsVoice struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language"`
+}
+
+// Synthesizer turns text into speech for one tts backend.
+type Synthesizer interface {
+	// Voices lists the voices accepted by Synthesize, the first one is the
+	// default.
+	Voices(ctx context.Context) ([]ttsVoice, error)
+	// MaxChunkChars is the longest text Synthesize accepts in one call,
+	// longer text is split and the resulting audio concatenated.
+	MaxChunkChars() int
+	// Synthesize returns encoded audio along with its AudioFormat.
+	Synthesize(ctx context.Context, text, voice string) ([]byte, string, error)
+}
+
+func newSynthesizer(engine string) (Synthesizer, bool) {
+	switch engine {
+	case "imtranslator":
+		return &imTranslatorSynthesizer{}, true
+	case "moonbase":
+		return newLocalSynthesizer(), true
+	case "playht":
+		return &playHTSynthesizer{
+			userID: os.Getenv("PLAYHT_USER_ID"),
+			apiKey: os.Getenv("PLAYHT_API_KEY"),
+		}, true
+	case "tiktok":
+		endpoint := os.Getenv("TIKTOK_TTS_URL")
+		if endpoint == "" {
+			endpoint = "https://tiktok-tts.weilnet.workers.dev/api/generation"
+		}
+		return &tiktokSynthesizer{endpoint: endpoint}, true
+	}
+	return nil, false
+}
+
+// chunkText splits text into pieces no longer than maxChars, preferring
+// sentence boundaries, then word boundaries, and only cutting words that are
+// longer than maxChars on their own.
+func chunkText(text string, maxChars int) []string {
+	text = strings.Join(strings.Fields(text), " ")
+	if maxChars <= 0 || len([]rune(text)) <= maxChars {
+		return []string{text}
+	}
+
+	var sentences []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		if (r == '.' || r == '!' || r == '?' || r == ';') && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])) {
+			sentences = append(sentences, strings.TrimSpace(string(runes[start:i+1])))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(string(runes[start:])); rest != "" {
+		sentences = append(sentences, rest)
+	}
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+	}
+	add := func(piece string) {
+		if current.Len() > 0 && len([]rune(current.String()))+1+len([]rune(piece)) > maxChars {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(piece)
+	}
+
+	for _, sentence := range sentences {
+		if len([]rune(sentence)) <= maxChars {
+			add(sentence)
+			continue
+		}
+		for _, word := range strings.Fields(sentence) {
+			wordRunes := []rune(word)
+			for len(wordRunes) > maxChars {
+				flush()
+				chunks = append(chunks, string(wordRunes[:maxChars]))
+				wordRunes = wordRunes[maxChars:]
+			}
+			if len(wordRunes) > 0 {
+				add(string(wordRunes))
+			}
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// transcodeAudio converts audio to the requested format with ffmpeg. Opus in
+// an ogg container at 48kHz is what discord voice plays without resampling.
+func transcodeAudio(ctx context.Context, audio []byte, format string) ([]byte, error) {
+	ffmpeg := os.Getenv("FFMPEG_PATH")
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}
+	switch format {
+	case AudioFormatOgg:
+		args = append(args, "-c:a", "libopus", "-b:a", "64k", "-ar", "48000", "-f", "ogg")
+	case AudioFormatMP3:
+		args = append(args, "-c:a", "libmp3lame", "-b:a", "128k", "-f", "mp3")
+	default:
+		return nil, fmt.Errorf("unsupported audio format %q", format)
+	}
+	args = append(args, "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	cmd.Stdin = bytes.NewReader(audio)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func synthesizeText(ctx context.Context, s Synthesizer, text, voice, format string) ([]byte, string, error) {
+	var audio []byte
+	sourceFormat := ""
+	for _, chunk := range chunkText(text, s.MaxChunkChars()) {
+		data, chunkFormat, err := s.Synthesize(ctx, chunk, voice)
+		if err != nil {
+			return nil, "", err
+		}
+		// mp3 frames can simply be appended, wav and ogg can not, which is
+		// why backends producing those never chunk
+		if sourceFormat != "" && chunkFormat != AudioFormatMP3 {
+			return nil, "", fmt.Errorf("cannot concatenate %s audio", chunkFormat)
+		}
+		sourceFormat = chunkFormat
+		audio = append(audio, data...)
+	}
+
+	if sourceFormat == format {
+		return audio, format, nil
+	}
+
+	transcoded, err := transcodeAudio(ctx, audio, format)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, "", fmt.Errorf("%w: ffmpeg is needed to convert %s to %s", errTTSNotConfigured, sourceFormat, format)
+		}
+		return nil, "", err
+	}
+	return transcoded, format, nil
+}
+
+func resolveTTSVoice(ctx context.Context, s Synthesizer, voice string) (string, error) {
+	voices, err := s.Voices(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(voices) == 0 {
+		return "", errors.New("no voices available")
+	}
+	if voice == "" {
+		return voices[0].ID, nil
+	}
+	for _, v := range voices {
+		if strings.EqualFold(v.ID, voice) {
+			return v.ID, nil
+		}
+	}
+	return "", fmt.Errorf("unknown voice %q", voice)
+}
+
+func serveTTS(w http.ResponseWriter, r *http.Request, engine string) {
+	startTime := time.Now()
+	rw := newResponseWriter(w, startTime)
+
+	s, ok := newSynthesizer(engine)
+	if !ok {
+		rw.writeError(StatusError, "unknown tts engine")
+		return
+	}
+
+	text := strings.TrimSpace(r.URL.Query().Get("text"))
+	if text == "" {
+		rw.writeError(StatusError, "missing 'text' query parameter")
+		return
+	}
+	if len([]rune(text)) > ttsMaxTextChars {
+		rw.writeError(StatusError, fmt.Sprintf("text is longer than %d characters", ttsMaxTextChars))
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = AudioFormatOgg
+	}
+	if format != AudioFormatOgg && format != AudioFormatMP3 {
+		rw.writeError(StatusError, "invalid 'format' query parameter, expected ogg or mp3")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ttsTimeout)
+	defer cancel()
+
+	voice, err := resolveTTSVoice(ctx, s, r.URL.Query().Get("voice"))
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	audio, audioFormat, err := synthesizeText(ctx, s, text, voice, format)
+	if err != nil {
+		if errors.Is(err, errTTSNotConfigured) {
+			rw.writeError(StatusError, err.Error())
+			return
+		}
+		rw.writeError(StatusError, "failed to synthesize speech")
+		return
+	}
+
+	w.Header().Set("Content-Type", audioContentTypes[audioFormat])
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(audio)))
+	w.Header().Set("X-Voice", voice)
+	w.Write(audio)
+}
+
+func TTSImTranslator(w http.ResponseWriter, r *http.Request) {
+	serveTTS(w, r, "imtranslator")
+}
+
+func TTSMoonbase(w http.ResponseWriter, r *http.Request) {
+	serveTTS(w, r, "moonbase")
+}
+
+func TTSPlayHT(w http.ResponseWriter, r *http.Request) {
+	serveTTS(w, r, "playht")
+}
+
+func TTSTikTok(w http.ResponseWriter, r *http.Request) {
+	serveTTS(w, r, "tiktok")
+}
+
+func GetTTSVoices(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	engine := r.URL.Query().Get("engine")
+	if engine == "" {
+		rw.writeError(StatusError, "missing 'engine' query parameter")
+		return
+	}
+
+	s, ok := newSynthesizer(engine)
+	if !ok {
+		rw.writeError(StatusError, "unknown tts engine")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ttsTimeout)
+	defer cancel()
+
+	voices, err := s.Voices(ctx)
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":    StatusSuccess,
+		"engine":    engine,
+		"max_chars": ttsMaxTextChars,
+		"voices":    voices,
+	})
+}
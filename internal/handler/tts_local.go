@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// localSynthesizer runs a tts binary on this machine, so it keeps working
+// without network access. DECtalk is used when DECTALK_PATH points at its
+// "say" binary, espeak-ng otherwise.
+type localSynthesizer struct {
+	dectalk string
+	espeak  string
+}
+
+type localVoice struct {
+	ttsVoice
+	// dectalkCode is the letter used by the [:n] speaker command
+	dectalkCode string
+	// espeakVariant approximates the dectalk speaker with espeak-ng
+	espeakVariant string
+}
+
+var localVoices = []localVoice{
+	{ttsVoice{ID: "paul", Name: "Perfect Paul", Language: "en-US"}, "p", "en-us+m3"},
+	{ttsVoice{ID: "harry", Name: "Huge Harry", Language: "en-US"}, "h", "en-us+m1"},
+	{ttsVoice{ID: "frank", Name: "Frail Frank", Language: "en-US"}, "f", "en-us+m7"},
+	{ttsVoice{ID: "dennis", Name: "Doctor Dennis", Language: "en-US"}, "d", "en-us+m2"},
+	{ttsVoice{ID: "betty", Name: "Beautiful Betty", Language: "en-US"}, "b", "en-us+f2"},
+	{ttsVoice{ID: "ursula", Name: "Uppity Ursula", Language: "en-US"}, "u", "en-us+f1"},
+	{ttsVoice{ID: "wendy", Name: "Whispering Wendy", Language: "en-US"}, "w", "en-us+whisperf"},
+	{ttsVoice{ID: "rita", Name: "Rough Rita", Language: "en-US"}, "r", "en-us+f4"},
+	{ttsVoice{ID: "kit", Name: "Kit the Kid", Language: "en-US"}, "k", "en-us+f5"},
+}
+
+func newLocalSynthesizer() *localSynthesizer {
+	espeak := os.Getenv("ESPEAK_PATH")
+	if espeak == "" {
+		espeak = "espeak-ng"
+	}
+	return &localSynthesizer{
+		dectalk: os.Getenv("DECTALK_PATH"),
+		espeak:  espeak,
+	}
+}
+
+func (l *localSynthesizer) Voices(ctx context.Context) ([]ttsVoice, error) {
+	voices := make([]ttsVoice, 0, len(localVoices))
+	for _, v := range localVoices {
+		voices = append(voices, v.ttsVoice)
+	}
+	return voices, nil
+}
+
+// MaxChunkChars is zero as both engines take arbitrarily long input and wav
+// output can not be concatenated.
+func (l *localSynthesizer) MaxChunkChars() int {
+	return 0
+}
+
+func (l *localSynthesizer) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	v := localVoices[0]
+	for _, candidate := range localVoices {
+		if candidate.ID == voice {
+			v = candidate
+		}
+	}
+
+	if l.dectalk != "" {
+		return l.synthesizeDECtalk(ctx, text, v)
+	}
+	return l.synthesizeEspeak(ctx, text, v)
+}
+
+func (l *localSynthesizer) synthesizeDECtalk(ctx context.Context, text string, v localVoice) ([]byte, string, error) {
+	out, err := os.CreateTemp("", "meteor-dectalk-*.wav")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	// phoneme mode is what makes the moonbase alpha [duw<500,19>] singing work
+	prefix := fmt.Sprintf("[:phoneme on][:n%s]", v.dectalkCode)
+
+	var stderr bytes.Buffer
+	// like espeak the text goes through stdin, as an argument it could be
+	// parsed as a flag
+	cmd := exec.CommandContext(ctx, l.dectalk, "-fo", out.Name(), "-pre", prefix)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("dectalk failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	audio, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read dectalk output: %w", err)
+	}
+	return audio, AudioFormatWAV, nil
+}
+
+func (l *localSynthesizer) synthesizeEspeak(ctx context.Context, text string, v localVoice) ([]byte, string, error) {
+	if _, err := exec.LookPath(l.espeak); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errTTSNotConfigured, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	// text goes through stdin so it can never be parsed as a flag
+	cmd := exec.CommandContext(ctx, l.espeak, "-v", v.espeakVariant, "--stdout")
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, "", fmt.Errorf("espeak-ng failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), AudioFormatWAV, nil
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ttsClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+func doTTSRequest(req *http.Request) ([]byte, error) {
+	resp, err := ttsClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+type tiktokSynthesizer struct {
+	endpoint string
+}
+
+var tiktokVoices = []ttsVoice{
+	{ID: "en_us_001", Name: "English US Female", Language: "en-US"},
+	{ID: "en_us_006", Name: "English US Male 1", Language: "en-US"},
+	{ID: "en_us_007", Name: "English US Male 2", Language: "en-US"},
+	{ID: "en_us_009", Name: "English US Male 3", Language: "en-US"},
+	{ID: "en_us_010", Name: "English US Male 4", Language: "en-US"},
+	{ID: "en_uk_001", Name: "English UK Male 1", Language: "en-GB"},
+	{ID: "en_uk_003", Name: "English UK Male 2", Language: "en-GB"},
+	{ID: "en_au_001", Name: "English AU Female", Language: "en-AU"},
+	{ID: "en_au_002", Name: "English AU Male", Language: "en-AU"},
+	{ID: "en_us_ghostface", Name: "Ghost Face", Language: "en-US"},
+	{ID: "en_us_chewbacca", Name: "Chewbacca", Language: "en-US"},
+	{ID: "en_us_c3po", Name: "C3PO", Language: "en-US"},
+	{ID: "en_us_stitch", Name: "Stitch", Language: "en-US"},
+	{ID: "en_us_stormtrooper", Name: "Stormtrooper", Language: "en-US"},
+	{ID: "en_us_rocket", Name: "Rocket", Language: "en-US"},
+	{ID: "en_male_narration", Name: "Story Teller", Language: "en-US"},
+	{ID: "en_male_funny", Name: "Wacky", Language: "en-US"},
+	{ID: "en_female_emotional", Name: "Peaceful", Language: "en-US"},
+	{ID: "fr_001", Name: "French Male 1", Language: "fr-FR"},
+	{ID: "fr_002", Name: "French Male 2", Language: "fr-FR"},
+	{ID: "de_001", Name: "German Female", Language: "de-DE"},
+	{ID: "de_002", Name: "German Male", Language: "de-DE"},
+	{ID: "es_002", Name: "Spanish Male", Language: "es-ES"},
+	{ID: "es_mx_002", Name: "Spanish MX Male", Language: "es-MX"},
+	{ID: "br_001", Name: "Portuguese BR Female 1", Language: "pt-BR"},
+	{ID: "br_005", Name: "Portuguese BR Male", Language: "pt-BR"},
+	{ID: "id_001", Name: "Indonesian Female", Language: "id-ID"},
+	{ID: "jp_001", Name: "Japanese Female 1", Language: "ja-JP"},
+	{ID: "jp_006", Name: "Japanese Male", Language: "ja-JP"},
+	{ID: "kr_002", Name: "Korean Male 1", Language: "ko-KR"},
+	{ID: "kr_003", Name: "Korean Female", Language: "ko-KR"},
+}
+
+func (t *tiktokSynthesizer) Voices(ctx context.Context) ([]ttsVoice, error) {
+	return tiktokVoices, nil
+}
+
+func (t *tiktokSynthesizer) MaxChunkChars() int {
+	return 300
+}
+
+func (t *tiktokSynthesizer) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	payload, err := json.Marshal(map[string]string{"text": text, "voice": voice})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := doTTSRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result struct {
+		Success bool   `json:"success"`
+		Data    string `json:"data"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, "", fmt.Errorf("decode failed: %w", err)
+	}
+	if !result.Success {
+		return nil, "", fmt.Errorf("tiktok tts error: %s", result.Error)
+	}
+
+	audio, err := base64.StdEncoding.DecodeString(result.Data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode audio: %w", err)
+	}
+	return audio, AudioFormatMP3, nil
+}
+
+// imTranslatorSynthesizer provides the voices offered by ImTranslator, which
+// are served by the google translate tts endpoint it uses itself.
+type imTranslatorSynthesizer struct{}
+
+var imTranslatorVoices = []ttsVoice{
+	{ID: "en", Name: "English", Language: "en"},
+	{ID: "en-GB", Name: "English (UK)", Language: "en-GB"},
+	{ID: "de", Name: "German", Language: "de"},
+	{ID: "fr", Name: "French", Language: "fr"},
+	{ID: "es", Name: "Spanish", Language: "es"},
+	{ID: "it", Name: "Italian", Language: "it"},
+	{ID: "pt", Name: "Portuguese", Language: "pt"},
+	{ID: "nl", Name: "Dutch", Language: "nl"},
+	{ID: "pl", Name: "Polish", Language: "pl"},
+	{ID: "ru", Name: "Russian", Language: "ru"},
+	{ID: "uk", Name: "Ukrainian", Language: "uk"},
+	{ID: "tr", Name: "Turkish", Language: "tr"},
+	{ID: "ar", Name: "Arabic", Language: "ar"},
+	{ID: "hi", Name: "Hindi", Language: "hi"},
+	{ID: "ja", Name: "Japanese", Language: "ja"},
+	{ID: "ko", Name: "Korean", Language: "ko"},
+	{ID: "zh-CN", Name: "Chinese (Simplified)", Language: "zh-CN"},
+	{ID: "zh-TW", Name: "Chinese (Traditional)", Language: "zh-TW"},
+}
+
+func (i *imTranslatorSynthesizer) Voices(ctx context.Context) ([]ttsVoice, error) {
+	return imTranslatorVoices, nil
+}
+
+func (i *imTranslatorSynthesizer) MaxChunkChars() int {
+	return 200
+}
+
+func (i *imTranslatorSynthesizer) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	apiURL := fmt.Sprintf(
+		"https://translate.google.com/translate_tts?ie=UTF-8&client=tw-ob&tl=%s&q=%s",
+		url.QueryEscape(voice), url.QueryEscape(text),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", getDDGHeaders()["User-Agent"])
+
+	audio, err := doTTSRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return audio, AudioFormatMP3, nil
+}
+
+type playHTSynthesizer struct {
+	userID string
+	apiKey string
+}
+
+var playHTVoiceCache = newTTLCache[[]ttsVoice](24*time.Hour, 1)
+
+func (p *playHTSynthesizer) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	if p.userID == "" || p.apiKey == "" {
+		return nil, errTTSNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", p.apiKey)
+	req.Header.Set("X-User-Id", p.userID)
+	return req, nil
+}
+
+func (p *playHTSynthesizer) Voices(ctx context.Context) ([]ttsVoice, error) {
+	if cached, ok := playHTVoiceCache.get("voices"); ok {
+		return cached, nil
+	}
+
+	req, err := p.newRequest(ctx, "GET", "https://api.play.ht/api/v2/voices", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	body, err := doTTSRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		LanguageCode string `json:"language_code"`
+	}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	voices := make([]ttsVoice, 0, len(entries))
+	for _, e := range entries {
+		voices = append(voices, ttsVoice{ID: e.ID, Name: e.Name, Language: e.LanguageCode})
+	}
+	if len(voices) == 0 {
+		return nil, errors.New("no playht voices available")
+	}
+
+	playHTVoiceCache.set("voices", voices)
+	return voices, nil
+}
+
+func (p *playHTSynthesizer) MaxChunkChars() int {
+	return 2000
+}
+
+func (p *playHTSynthesizer) Synthesize(ctx context.Context, text, voice string) ([]byte, string, error) {
+	payload, err := json.Marshal(map[string]string{
+		"text":          text,
+		"voice":         voice,
+		"output_format": "mp3",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := p.newRequest(ctx, "POST", "https://api.play.ht/api/v2/tts/stream", bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/mpeg")
+
+	audio, err := doTTSRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+	return audio, AudioFormatMP3, nil
+}
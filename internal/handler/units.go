@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type unitDefinition struct {
+	name     string
+	symbol   string
+	category string
+	// factor converts the unit to its category base unit, offset is added
+	// afterwards and is only used by temperatures
+	factor  float64
+	offset  float64
+	aliases []string
+}
+
+var unitDefinitions = []unitDefinition{
+	// length, base meter
+	{name: "meter", symbol: "m", category: "length", factor: 1, aliases: []string{"meters", "metre", "metres"}},
+	{name: "kilometer", symbol: "km", category: "length", factor: 1000, aliases: []string{"kilometers", "kilometre", "kilometres", "kms"}},
+	{name: "centimeter", symbol: "cm", category: "length", factor: 0.01, aliases: []string{"centimeters", "centimetre", "centimetres"}},
+	{name: "millimeter", symbol: "mm", category: "length", factor: 0.001, aliases: []string{"millimeters", "millimetre", "millimetres"}},
+	{name: "micrometer", symbol: "µm", category: "length", factor: 1e-6, aliases: []string{"um", "micrometers", "micron", "microns"}},
+	{name: "nanometer", symbol: "nm", category: "length", factor: 1e-9, aliases: []string{"nanometers", "nanometre", "nanometres"}},
+	{name: "mile", symbol: "mi", category: "length", factor: 1609.344, aliases: []string{"miles"}},
+	{name: "yard", symbol: "yd", category: "length", factor: 0.9144, aliases: []string{"yards", "yds"}},
+	{name: "foot", symbol: "ft", category: "length", factor: 0.3048, aliases: []string{"feet", "'"}},
+	{name: "inch", symbol: "in", category: "length", factor: 0.0254, aliases: []string{"inches", "\""}},
+	{name: "nautical mile", symbol: "nmi", category: "length", factor: 1852, aliases: []string{"nautical miles"}},
+	{name: "astronomical unit", symbol: "au", category: "length", factor: 149597870700, aliases: []string{"astronomical units"}},
+	{name: "light year", symbol: "ly", category: "length", factor: 9460730472580800, aliases: []string{"light years", "lightyear", "lightyears"}},
+
+	// mass, base kilogram
+	{name: "kilogram", symbol: "kg", category: "mass", factor: 1, aliases: []string{"kilograms", "kilo", "kilos", "kgs"}},
+	{name: "gram", symbol: "g", category: "mass", factor: 0.001, aliases: []string{"grams", "gramme", "grammes"}},
+	{name: "milligram", symbol: "mg", category: "mass", factor: 1e-6, aliases: []string{"milligrams"}},
+	{name: "microgram", symbol: "µg", category: "mass", factor: 1e-9, aliases: []string{"ug", "mcg", "micrograms"}},
+	{name: "tonne", symbol: "t", category: "mass", factor: 1000, aliases: []string{"tonnes", "metric ton", "metric tons"}},
+	{name: "pound", symbol: "lb", category: "mass", factor: 0.45359237, aliases: []string{"pounds", "lbs"}},
+	{name: "ounce", symbol: "oz", category: "mass", factor: 0.028349523125, aliases: []string{"ounces"}},
+	{name: "stone", symbol: "st", category: "mass", factor: 6.35029318, aliases: []string{"stones"}},
+	{name: "short ton", symbol: "ton", category: "mass", factor: 907.18474, aliases: []string{"tons", "short tons"}},
+
+	// temperature, base kelvin
+	{name: "celsius", symbol: "°C", category: "temperature", factor: 1, offset: 273.15, aliases: []string{"c", "degc", "degrees celsius", "centigrade"}},
+	{name: "fahrenheit", symbol: "°F", category: "temperature", factor: 5.0 / 9.0, offset: 459.67 * 5.0 / 9.0, aliases: []string{"f", "degf", "degrees fahrenheit"}},
+	{name: "kelvin", symbol: "K", category: "temperature", factor: 1, aliases: []string{"k", "kelvins"}},
+
+	// data, base byte
+	{name: "bit", symbol: "b", category: "data", factor: 0.125, aliases: []string{"bits"}},
+	{name: "byte", symbol: "B", category: "data", factor: 1, aliases: []string{"bytes"}},
+	{name: "kilobit", symbol: "kb", category: "data", factor: 125, aliases: []string{"kbit", "kilobits"}},
+	{name: "megabit", symbol: "Mb", category: "data", factor: 125e3, aliases: []string{"mbit", "megabits"}},
+	{name: "gigabit", symbol: "Gb", category: "data", factor: 125e6, aliases: []string{"gbit", "gigabits"}},
+	{name: "kilobyte", symbol: "kB", category: "data", factor: 1e3, aliases: []string{"KB", "kilobytes"}},
+	{name: "megabyte", symbol: "MB", category: "data", factor: 1e6, aliases: []string{"megabytes"}},
+	{name: "gigabyte", symbol: "GB", category: "data", factor: 1e9, aliases: []string{"gigabytes"}},
+	{name: "terabyte", symbol: "TB", category: "data", factor: 1e12, aliases: []string{"terabytes"}},
+	{name: "petabyte", symbol: "PB", category: "data", factor: 1e15, aliases: []string{"petabytes"}},
+	{name: "kibibyte", symbol: "KiB", category: "data", factor: 1 << 10, aliases: []string{"kibibytes"}},
+	{name: "mebibyte", symbol: "MiB", category: "data", factor: 1 << 20, aliases: []string{"mebibytes"}},
+	{name: "gibibyte", symbol: "GiB", category: "data", factor: 1 << 30, aliases: []string{"gibibytes"}},
+	{name: "tebibyte", symbol: "TiB", category: "data", factor: 1 << 40, aliases: []string{"tebibytes"}},
+
+	// time, base second
+	{name: "nanosecond", symbol: "ns", category: "time", factor: 1e-9, aliases: []string{"nanoseconds"}},
+	{name: "microsecond", symbol: "µs", category: "time", factor: 1e-6, aliases: []string{"us", "microseconds"}},
+	{name: "millisecond", symbol: "ms", category: "time", factor: 1e-3, aliases: []string{"milliseconds", "msec"}},
+	{name: "second", symbol: "s", category: "time", factor: 1, aliases: []string{"seconds", "sec", "secs"}},
+	{name: "minute", symbol: "min", category: "time", factor: 60, aliases: []string{"minutes", "mins"}},
+	{name: "hour", symbol: "h", category: "time", factor: 3600, aliases: []string{"hours", "hr", "hrs"}},
+	{name: "day", symbol: "d", category: "time", factor: 86400, aliases: []string{"days"}},
+	{name: "week", symbol: "wk", category: "time", factor: 604800, aliases: []string{"weeks"}},
+	{name: "month", symbol: "mo", category: "time", factor: 2629746, aliases: []string{"months"}},
+	{name: "year", symbol: "yr", category: "time", factor: 31556952, aliases: []string{"years", "yrs"}},
+
+	// speed, base meter per second
+	{name: "meter per second", symbol: "m/s", category: "speed", factor: 1, aliases: []string{"meters per second", "mps"}},
+	{name: "kilometer per hour", symbol: "km/h", category: "speed", factor: 1000.0 / 3600.0, aliases: []string{"kph", "kmh", "kmph", "kilometers per hour"}},
+	{name: "mile per hour", symbol: "mph", category: "speed", factor: 0.44704, aliases: []string{"mi/h", "miles per hour"}},
+	{name: "knot", symbol: "kn", category: "speed", factor: 1852.0 / 3600.0, aliases: []string{"knots", "kt", "kts"}},
+	{name: "foot per second", symbol: "ft/s", category: "speed", factor: 0.3048, aliases: []string{"fps", "feet per second"}},
+
+	// area, base square meter
+	{name: "square meter", symbol: "m²", category: "area", factor: 1, aliases: []string{"m2", "sqm", "square meters", "square metres"}},
+	{name: "square kilometer", symbol: "km²", category: "area", factor: 1e6, aliases: []string{"km2", "square kilometers", "square kilometres"}},
+	{name: "square mile", symbol: "mi²", category: "area", factor: 2589988.110336, aliases: []string{"mi2", "square miles"}},
+	{name: "square foot", symbol: "ft²", category: "area", factor: 0.09290304, aliases: []string{"ft2", "sqft", "square feet"}},
+	{name: "hectare", symbol: "ha", category: "area", factor: 1e4, aliases: []string{"hectares"}},
+	{name: "acre", symbol: "ac", category: "area", factor: 4046.8564224, aliases: []string{"acres"}},
+
+	// volume, base liter
+	{name: "liter", symbol: "L", category: "volume", factor: 1, aliases: []string{"l", "liters", "litre", "litres"}},
+	{name: "milliliter", symbol: "mL", category: "volume", factor: 1e-3, aliases: []string{"ml", "milliliters", "millilitre", "millilitres"}},
+	{name: "cubic meter", symbol: "m³", category: "volume", factor: 1000, aliases: []string{"m3", "cubic meters", "cubic metres"}},
+	{name: "gallon", symbol: "gal", category: "volume", factor: 3.785411784, aliases: []string{"gallons", "us gallon", "us gallons"}},
+	{name: "quart", symbol: "qt", category: "volume", factor: 0.946352946, aliases: []string{"quarts"}},
+	{name: "pint", symbol: "pt", category: "volume", factor: 0.473176473, aliases: []string{"pints"}},
+	{name: "cup", symbol: "cup", category: "volume", factor: 0.2365882365, aliases: []string{"cups"}},
+	{name: "fluid ounce", symbol: "fl oz", category: "volume", factor: 0.0295735295625, aliases: []string{"floz", "fluid ounces"}},
+	{name: "tablespoon", symbol: "tbsp", category: "volume", factor: 0.01478676478125, aliases: []string{"tablespoons"}},
+	{name: "teaspoon", symbol: "tsp", category: "volume", factor: 0.00492892159375, aliases: []string{"teaspoons"}},
+
+	// energy, base joule
+	{name: "joule", symbol: "J", category: "energy", factor: 1, aliases: []string{"j", "joules"}},
+	{name: "kilojoule", symbol: "kJ", category: "energy", factor: 1e3, aliases: []string{"kj", "kilojoules"}},
+	{name: "calorie", symbol: "cal", category: "energy", factor: 4.184, aliases: []string{"calories"}},
+	{name: "kilocalorie", symbol: "kcal", category: "energy", factor: 4184, aliases: []string{"kilocalories", "food calories"}},
+	{name: "kilowatt hour", symbol: "kWh", category: "energy", factor: 3.6e6, aliases: []string{"kwh", "kilowatt hours"}},
+	{name: "electronvolt", symbol: "eV", category: "energy", factor: 1.602176634e-19, aliases: []string{"ev", "electronvolts"}},
+
+	// pressure, base pascal
+	{name: "pascal", symbol: "Pa", category: "pressure", factor: 1, aliases: []string{"pa", "pascals"}},
+	{name: "kilopascal", symbol: "kPa", category: "pressure", factor: 1e3, aliases: []string{"kpa", "kilopascals"}},
+	{name: "bar", symbol: "bar", category: "pressure", factor: 1e5, aliases: []string{"bars"}},
+	{name: "hectopascal", symbol: "hPa", category: "pressure", factor: 100, aliases: []string{"hpa", "millibar", "mbar"}},
+	{name: "atmosphere", symbol: "atm", category: "pressure", factor: 101325, aliases: []string{"atmospheres"}},
+	{name: "pound per square inch", symbol: "psi", category: "pressure", factor: 6894.757293168, aliases: []string{"pounds per square inch"}},
+}
+
+var (
+	// symbols are matched case-sensitively first so "Mb" and "MB" stay
+	// distinct, everything else is matched case-insensitively
+	unitsBySymbol = map[string]*unitDefinition{}
+	unitsByAlias  = map[string]*unitDefinition{}
+)
+
+func init() {
+	for i := range unitDefinitions {
+		u := &unitDefinitions[i]
+		unitsBySymbol[u.symbol] = u
+		for _, alias := range append([]string{u.name, u.symbol}, u.aliases...) {
+			lower := strings.ToLower(alias)
+			if _, exists := unitsByAlias[lower]; !exists {
+				unitsByAlias[lower] = u
+			}
+		}
+		for _, alias := range u.aliases {
+			if _, exists := unitsBySymbol[alias]; !exists {
+				unitsBySymbol[alias] = u
+			}
+		}
+	}
+}
+
+// lookupUnit resolves a unit name. symbols are matched case-sensitively so
+// "Mb" and "MB" stay distinct, except lowercase data sizes like "mb" or "kb":
+// people mean bytes by them far more often than bits, so they always resolve
+// to bytes and a conversion never mixes the two by accident. bits can still
+// be asked for with "Mb", "kbit" or "bits".
+func lookupUnit(name string) *unitDefinition {
+	name = strings.TrimSpace(name)
+	name = strings.TrimPrefix(name, "degrees ")
+	name = strings.TrimPrefix(name, "deg ")
+	lower := strings.ToLower(name)
+	if name == lower && len(lower) > 1 && strings.HasSuffix(lower, "b") {
+		if u, ok := unitsBySymbol[strings.ToUpper(lower)]; ok {
+			return u
+		}
+	}
+	if u, ok := unitsBySymbol[name]; ok {
+		return u
+	}
+	return unitsByAlias[lower]
+}
+
+var unitConversionPattern = regexp.MustCompile(`(?i)^\s*(-?[\d.,_]+(?:e[+-]?\d+)?)\s*(.+?)\s+(?:to|in|into|as|=|->)\s+(.+?)\s*$`)
+
+type unitConversion struct {
+	value float64
+	from  *unitDefinition
+	to    *unitDefinition
+}
+
+func parseUnitConversion(query string) (unitConversion, bool) {
+	matches := unitConversionPattern.FindStringSubmatch(query)
+	if matches == nil {
+		return unitConversion{}, false
+	}
+
+	value, err := strconv.ParseFloat(strings.NewReplacer(",", "", "_", "").Replace(matches[1]), 64)
+	if err != nil {
+		return unitConversion{}, false
+	}
+
+	from := lookupUnit(matches[2])
+	to := lookupUnit(matches[3])
+	if from == nil || to == nil {
+		return unitConversion{}, false
+	}
+
+	return unitConversion{value: value, from: from, to: to}, true
+}
+
+func convertUnit(c unitConversion) (float64, error) {
+	if c.from.category != c.to.category {
+		return 0, fmt.Errorf("cannot convert %s to %s", c.from.category, c.to.category)
+	}
+	base := c.value*c.from.factor + c.from.offset
+	result := (base - c.to.offset) / c.to.factor
+	// json can't encode infinities, "1e308 ly to nm" would blank the response
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errCalcDomain
+	}
+	return result, nil
+}
+
+func formatUnitValue(value float64) string {
+	if value != 0 && (math.Abs(value) >= 1e15 || math.Abs(value) < 1e-6) {
+		return strconv.FormatFloat(value, 'g', 10, 64)
+	}
+	return strconv.FormatFloat(math.Round(value*1e9)/1e9, 'f', -1, 64)
+}
+
+func buildUnitConverterResult(c unitConversion) (map[string]interface{}, error) {
+	converted, err := convertUnit(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"type": SearchResultTypeUnitConverter,
+		"result": map[string]interface{}{
+			"category": c.from.category,
+			"from": map[string]interface{}{
+				"value":     c.value,
+				"formatted": formatUnitValue(c.value),
+				"unit":      c.from.name,
+				"symbol":    c.from.symbol,
+			},
+			"to": map[string]interface{}{
+				"value":     converted,
+				"formatted": formatUnitValue(converted),
+				"unit":      c.to.name,
+				"symbol":    c.to.symbol,
+			},
+		},
+	}, nil
+}
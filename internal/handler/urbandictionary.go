@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const urbanAPIURL = "https://api.urbandictionary.com/v0/"
+
+// urbanCrossRefPattern matches ud's [word] markup, which links to the
+// definition of that word
+var urbanCrossRefPattern = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+type urbanEntry struct {
+	DefID      int64  `json:"defid"`
+	Word       string `json:"word"`
+	Permalink  string `json:"permalink"`
+	Definition string `json:"definition"`
+	Author     string `json:"author"`
+	WrittenOn  string `json:"written_on"`
+	Example    string `json:"example"`
+	ThumbsUp   int    `json:"thumbs_up"`
+	ThumbsDown int    `json:"thumbs_down"`
+	Date       string `json:"date"`
+}
+
+type urbanResponse struct {
+	List []urbanEntry `json:"list"`
+}
+
+func urbanTermURL(term string) string {
+	return "https://www.urbandictionary.com/define.php?term=" + url.QueryEscape(term)
+}
+
+// parseUrbanText drops the brackets of cross references and returns them as
+// links, in order and without repeats
+func parseUrbanText(text string) (string, []map[string]interface{}) {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+
+	links := []map[string]interface{}{}
+	seen := map[string]bool{}
+	for _, m := range urbanCrossRefPattern.FindAllStringSubmatch(text, -1) {
+		term := strings.TrimSpace(m[1])
+		key := strings.ToLower(term)
+		if term == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		links = append(links, map[string]interface{}{
+			"text": m[1],
+			"term": term,
+			"link": urbanTermURL(term),
+		})
+	}
+	return urbanCrossRefPattern.ReplaceAllString(text, "$1"), links
+}
+
+func buildUrbanEntry(entry urbanEntry) map[string]interface{} {
+	definition, definitionLinks := parseUrbanText(entry.Definition)
+	example, exampleLinks := parseUrbanText(entry.Example)
+	return map[string]interface{}{
+		"id":                entry.DefID,
+		"title":             entry.Word,
+		"link":              entry.Permalink,
+		"description":       definition,
+		"description_links": definitionLinks,
+		"author":            entry.Author,
+		"date":              entry.WrittenOn,
+		"example":           example,
+		"example_links":     exampleLinks,
+		"score": map[string]interface{}{
+			"likes":    entry.ThumbsUp,
+			"dislikes": entry.ThumbsDown,
+		},
+	}
+}
+
+func buildUrbanEntries(entries []urbanEntry) []map[string]interface{} {
+	results := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, buildUrbanEntry(entry))
+	}
+	return results
+}
+
+func parseUrbanPage(query url.Values) (int, error) {
+	raw := query.Get("page")
+	if raw == "" {
+		return 1, nil
+	}
+	page, err := strconv.Atoi(raw)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid 'page' query parameter %q", raw)
+	}
+	return page, nil
+}
+
+func fetchUrbanList(endpoint string, params url.Values) ([]urbanEntry, error) {
+	var response urbanResponse
+	if err := fetchJSON(urbanAPIURL+endpoint+"?"+params.Encode(), &response); err != nil {
+		return nil, err
+	}
+	return response.List, nil
+}
+
+func SearchUrbanDictionary(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		rw.writeError(StatusError, "missing query parameter 'q'")
+		return
+	}
+
+	page, err := parseUrbanPage(r.URL.Query())
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy != "" && sortBy != "relevance" && sortBy != "score" {
+		rw.writeError(StatusError, "unsupported 'sort' query parameter, expected 'relevance' or 'score'")
+		return
+	}
+
+	entries, err := fetchUrbanList("define", url.Values{"term": {query}, "page": {strconv.Itoa(page)}})
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch definition")
+		return
+	}
+
+	// ud pages by relevance, so sorting by score only reorders this page
+	if sortBy == "score" {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].ThumbsUp-entries[i].ThumbsDown > entries[j].ThumbsUp-entries[j].ThumbsDown
+		})
+	}
+
+	results := buildUrbanEntries(entries)
+
+	status := StatusSuccess
+	message := ""
+	if len(results) == 0 {
+		status = StatusNotFound
+		message = "no definitions found"
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  status,
+		"message": message,
+		"page":    page,
+		"results": results,
+	})
+}
+
+func SearchUrbanDictionaryRandom(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	entries, err := fetchUrbanList("random", url.Values{})
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch definitions")
+		return
+	}
+	if len(entries) == 0 {
+		rw.writeError(StatusNotFound, "no definitions found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"results": buildUrbanEntries(entries),
+	})
+}
+
+// SearchUrbanDictionaryWordOfTheDay lists the words of the day, newest first.
+// the first result of the first page is today's.
+func SearchUrbanDictionaryWordOfTheDay(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	page, err := parseUrbanPage(r.URL.Query())
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	entries, err := fetchUrbanList("words_of_the_day", url.Values{"page": {strconv.Itoa(page)}})
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch words of the day")
+		return
+	}
+	if len(entries) == 0 {
+		rw.writeError(StatusNotFound, "no words of the day found")
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		result := buildUrbanEntry(entry)
+		result["day"] = entry.Date
+		results = append(results, result)
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"page":    page,
+		"results": results,
+	})
+}
+
+func SearchUrbanDictionaryAutocomplete(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	var response struct {
+		Results []struct {
+			Term    string `json:"term"`
+			Preview string `json:"preview"`
+		} `json:"results"`
+	}
+	if err := fetchJSON(urbanAPIURL+"autocomplete-extra?"+url.Values{"term": {query}}.Encode(), &response); err != nil {
+		rw.writeError(StatusError, "failed to fetch suggestions")
+		return
+	}
+	if len(response.Results) == 0 {
+		rw.writeError(StatusNotFound, "no suggestions found")
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(response.Results))
+	for _, suggestion := range response.Results {
+		preview, _ := parseUrbanText(suggestion.Preview)
+		results = append(results, map[string]interface{}{
+			"term":    suggestion.Term,
+			"preview": preview,
+			"link":    urbanTermURL(suggestion.Term),
+		})
+	}
+
+	rw.write(map[string]interface{}{
+		"status":  StatusSuccess,
+		"results": results,
+	})
+}
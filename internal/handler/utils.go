@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -71,7 +72,9 @@ func normalizeURL(rawURL string) string {
 	return rawURL
 }
 
-func takeScreenshot(targetURL string) ([]byte, error) {
+// openBrowserPage launches a headless browser and opens a blank page bound to
+// ctx. The returned cleanup function closes the page and the browser.
+func openBrowserPage(ctx context.Context) (*rod.Page, func(), error) {
 	l := launcher.New().
 		Headless(true).
 		Set("disable-gpu").
@@ -80,24 +83,39 @@ func takeScreenshot(targetURL string) ([]byte, error) {
 
 	controlURL, err := l.Launch()
 	if err != nil {
-		return nil, fmt.Errorf("failed to launch browser: %w", err)
+		return nil, nil, fmt.Errorf("failed to launch browser: %w", err)
 	}
-	defer l.Cleanup()
 
 	browser := rod.New().ControlURL(controlURL)
 	if err := browser.Connect(); err != nil {
-		return nil, fmt.Errorf("failed to connect to browser: %w", err)
+		l.Cleanup()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %w", err)
+	}
+
+	page, err := browser.Context(ctx).Page(proto.TargetCreateTarget{URL: "about:blank"})
+	if err != nil {
+		browser.Close()
+		l.Cleanup()
+		return nil, nil, fmt.Errorf("failed to create page: %w", err)
 	}
-	defer browser.Close()
 
+	cleanup := func() {
+		page.Close()
+		browser.Close()
+		l.Cleanup()
+	}
+	return page, cleanup, nil
+}
+
+func takeScreenshot(targetURL string) ([]byte, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), screenshotTimeout)
 	defer cancel()
 
-	page, err := browser.Context(ctx).Page(proto.TargetCreateTarget{URL: "about:blank"})
+	page, cleanup, err := openBrowserPage(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create page: %w", err)
+		return nil, err
 	}
-	defer page.Close()
+	defer cleanup()
 
 	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
 		Width:  screenshotWidth,
@@ -128,6 +146,37 @@ func takeScreenshot(targetURL string) ([]byte, error) {
 	return screenshot, nil
 }
 
+// fetchRenderedHTML loads targetURL in the headless browser and returns the
+// html after scripts have run, for pages that render client side.
+func fetchRenderedHTML(targetURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), screenshotTimeout)
+	defer cancel()
+
+	page, cleanup, err := openBrowserPage(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	if err := page.Navigate(targetURL); err != nil {
+		return "", fmt.Errorf("failed to navigate: %w", err)
+	}
+
+	if err := page.WaitLoad(); err != nil {
+		return "", fmt.Errorf("failed to wait for page load: %w", err)
+	}
+
+	// this is to give the javascript time to load
+	time.Sleep(1000 * time.Millisecond)
+
+	html, err := page.HTML()
+	if err != nil {
+		return "", fmt.Errorf("failed to read page html: %w", err)
+	}
+
+	return html, nil
+}
+
 func Webshot(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
@@ -331,35 +380,53 @@ type dictEntry struct {
 	Origin    string         `json:"origin"`
 }
 
-func GetDictionary(w http.ResponseWriter, r *http.Request) {
-	rw := newResponseWriter(w, time.Now())
-
-	word := r.URL.Query().Get("word")
-	if word == "" {
-		rw.writeError(StatusError, "missing 'word' query parameter")
-		return
-	}
+var (
+	errWordNotFound     = errors.New("word not found")
+	errDictionaryDecode = errors.New("failed to decode dictionary response")
+)
 
+func fetchDictionaryAPI(word string) ([]dictEntry, error) {
 	urlStr := fmt.Sprintf("https://api.dictionaryapi.dev/api/v2/entries/en/%s", url.QueryEscape(word))
 
-	// The API returns an array of entries
-	var entries []dictEntry
-
 	// Handle 404 specifically as it returns a different JSON structure sometimes
 	resp, err := httpClient.Get(urlStr)
 	if err != nil {
-		rw.writeError(StatusError, "request failed")
-		return
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		rw.writeError(StatusNotFound, "word not found")
-		return
+		return nil, errWordNotFound
 	}
 
+	// The API returns an array of entries
+	var entries []dictEntry
 	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
-		rw.writeError(StatusError, "failed to decode dictionary response")
+		return nil, fmt.Errorf("%w: %v", errDictionaryDecode, err)
+	}
+	return entries, nil
+}
+
+func GetDictionary(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	word := r.URL.Query().Get("word")
+	if word == "" {
+		rw.writeError(StatusError, "missing 'word' query parameter")
+		return
+	}
+
+	entries, err := fetchDictionaryAPI(word)
+	if errors.Is(err, errWordNotFound) {
+		rw.writeError(StatusNotFound, "word not found")
+		return
+	}
+	if errors.Is(err, errDictionaryDecode) {
+		rw.writeError(StatusError, errDictionaryDecode.Error())
+		return
+	}
+	if err != nil {
+		rw.writeError(StatusError, "request failed")
 		return
 	}
 
@@ -0,0 +1,700 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	// open-meteo names the location's zone, minimal images have no zoneinfo
+	_ "time/tzdata"
+)
+
+const (
+	// geoCandidateCount is how many geocoding results are offered as
+	// alternatives when a name is ambiguous
+	geoCandidateCount = 5
+	// geoRegionSearchCount is how many are searched through for a region,
+	// the one asked for is rarely the most populous
+	geoRegionSearchCount = 30
+
+	defaultHourlyForecast = 24
+	maxHourlyForecast     = 48
+)
+
+var (
+	errLocationNotFound = errors.New("location not found")
+	errGeocodingFailed  = errors.New("failed to fetch geolocation")
+)
+
+type geoLocation struct {
+	ID          int64   `json:"id"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Name        string  `json:"name"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+	Admin1      string  `json:"admin1"`
+	Admin2      string  `json:"admin2"`
+	Timezone    string  `json:"timezone"`
+	Population  int64   `json:"population"`
+}
+
+type geoResponse struct {
+	Results []geoLocation `json:"results"`
+}
+
+type weatherCurrent struct {
+	Time             string  `json:"time"`
+	Temperature      float64 `json:"temperature_2m"`
+	ApparentTemp     float64 `json:"apparent_temperature"`
+	WeatherCode      int     `json:"weather_code"`
+	RelativeHumidity int     `json:"relative_humidity_2m"`
+	WindSpeed        float64 `json:"wind_speed_10m"`
+	WindGusts        float64 `json:"wind_gusts_10m"`
+	Visibility       float64 `json:"visibility"`
+	Pressure         float64 `json:"pressure_msl"`
+}
+
+type weatherHourly struct {
+	Time                     []string  `json:"time"`
+	WeatherCode              []int     `json:"weather_code"`
+	Temperature              []float64 `json:"temperature_2m"`
+	PrecipitationProbability []int     `json:"precipitation_probability"`
+	Precipitation            []float64 `json:"precipitation"`
+	WindGusts                []float64 `json:"wind_gusts_10m"`
+	UVIndex                  []float64 `json:"uv_index"`
+}
+
+type weatherDaily struct {
+	Time                     []string  `json:"time"`
+	WeatherCode              []int     `json:"weather_code"`
+	TempMax                  []float64 `json:"temperature_2m_max"`
+	TempMin                  []float64 `json:"temperature_2m_min"`
+	Sunrise                  []string  `json:"sunrise"`
+	Sunset                   []string  `json:"sunset"`
+	PrecipitationSum         []float64 `json:"precipitation_sum"`
+	PrecipitationProbability []int     `json:"precipitation_probability_max"`
+}
+
+// openMeteoTimezone is the zone open-meteo picked with timezone=auto. times
+// in its responses are local to it and have no offset of their own.
+type openMeteoTimezone struct {
+	Timezone             string `json:"timezone"`
+	TimezoneAbbreviation string `json:"timezone_abbreviation"`
+	UTCOffsetSeconds     int    `json:"utc_offset_seconds"`
+}
+
+// location returns the location's timezone. the fixed offset fallback is
+// only wrong across a dst change within the forecast.
+func (z openMeteoTimezone) location() *time.Location {
+	if z.Timezone != "" {
+		if tz, err := time.LoadLocation(z.Timezone); err == nil {
+			return tz
+		}
+	}
+	return time.FixedZone(z.TimezoneAbbreviation, z.UTCOffsetSeconds)
+}
+
+func (z openMeteoTimezone) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"name":         z.Timezone,
+		"abbreviation": z.TimezoneAbbreviation,
+		"utc_offset":   z.UTCOffsetSeconds,
+	}
+}
+
+type weatherResponse struct {
+	openMeteoTimezone
+	Current weatherCurrent `json:"current"`
+	Hourly  weatherHourly  `json:"hourly"`
+	Daily   weatherDaily   `json:"daily"`
+}
+
+// weatherUnits holds open-meteo unit names. open-meteo has no kelvin so it is
+// requested in celsius and converted afterwards, and it always returns
+// visibility in meters and pressure in hPa.
+type weatherUnits struct {
+	Temperature   string
+	WindSpeed     string
+	Precipitation string
+	Visibility    string
+	Pressure      string
+}
+
+var weatherUnitSystems = map[string]weatherUnits{
+	"metric":   {Temperature: "celsius", WindSpeed: "kmh", Precipitation: "mm", Visibility: "km", Pressure: "hpa"},
+	"imperial": {Temperature: "fahrenheit", WindSpeed: "mph", Precipitation: "inch", Visibility: "mi", Pressure: "inhg"},
+	"kelvin":   {Temperature: "kelvin", WindSpeed: "ms", Precipitation: "mm", Visibility: "km", Pressure: "hpa"},
+	"standard": {Temperature: "kelvin", WindSpeed: "ms", Precipitation: "mm", Visibility: "km", Pressure: "hpa"},
+}
+
+var windUnitAliases = map[string]string{
+	"kmh": "kmh", "km/h": "kmh", "kph": "kmh",
+	"ms": "ms", "m/s": "ms",
+	"mph": "mph",
+	"kn":  "kn", "kt": "kn", "knots": "kn",
+}
+
+var weatherUnitSymbols = map[string]string{
+	"celsius": "°C", "fahrenheit": "°F", "kelvin": "K",
+	"kmh": "km/h", "ms": "m/s", "mph": "mph", "kn": "kn",
+	"mm": "mm", "inch": "in",
+	"km": "km", "mi": "mi",
+	"hpa": "hPa", "inhg": "inHg",
+}
+
+// weatherOptions are the presentation parameters shared by the weather
+// endpoints
+type weatherOptions struct {
+	Units      weatherUnits
+	Lang       string
+	Hours      int
+	AirQuality bool
+}
+
+func parseWeatherOptions(query url.Values) (weatherOptions, error) {
+	opts := weatherOptions{
+		Units: weatherUnitSystems["metric"],
+		Lang:  weatherLanguage(query.Get("lang")),
+		Hours: defaultHourlyForecast,
+	}
+
+	if system := strings.ToLower(query.Get("units")); system != "" {
+		units, ok := weatherUnitSystems[system]
+		if !ok {
+			return opts, fmt.Errorf("invalid 'units' query parameter %q, expected metric, imperial or kelvin", system)
+		}
+		opts.Units = units
+	}
+
+	if raw := strings.ToLower(query.Get("wind_unit")); raw != "" {
+		unit, ok := windUnitAliases[raw]
+		if !ok {
+			return opts, fmt.Errorf("invalid 'wind_unit' query parameter %q, expected kmh, ms, mph or kn", raw)
+		}
+		opts.Units.WindSpeed = unit
+	}
+
+	if raw := query.Get("hours"); raw != "" {
+		hours, err := strconv.Atoi(raw)
+		if err != nil || hours < 0 || hours > maxHourlyForecast {
+			return opts, fmt.Errorf("invalid 'hours' query parameter %q, expected 0 to %d", raw, maxHourlyForecast)
+		}
+		opts.Hours = hours
+	}
+
+	opts.AirQuality = query.Get("air_quality") == "true" || query.Get("air_quality") == "1"
+	return opts, nil
+}
+
+// apiTemperatureUnit is the unit to request from open-meteo
+func (u weatherUnits) apiTemperatureUnit() string {
+	if u.Temperature == "kelvin" {
+		return "celsius"
+	}
+	return u.Temperature
+}
+
+// convert applies the unit conversions open-meteo can't do itself
+func (u weatherUnits) convert(weather *weatherResponse) {
+	current := &weather.Current
+	if u.Visibility == "mi" {
+		current.Visibility = roundTo(current.Visibility/1609.344, 1)
+	} else {
+		current.Visibility = roundTo(current.Visibility/1000, 1)
+	}
+	if u.Pressure == "inhg" {
+		current.Pressure = roundTo(current.Pressure*0.0295300, 2)
+	}
+
+	if u.Temperature != "kelvin" {
+		return
+	}
+	toKelvin := func(c float64) float64 {
+		return roundTo(c+273.15, 2)
+	}
+
+	current.Temperature = toKelvin(current.Temperature)
+	current.ApparentTemp = toKelvin(current.ApparentTemp)
+	for _, temps := range [][]float64{weather.Hourly.Temperature, weather.Daily.TempMax, weather.Daily.TempMin} {
+		for i := range temps {
+			temps[i] = toKelvin(temps[i])
+		}
+	}
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+func (u weatherUnits) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"temperature":   weatherUnitSymbols[u.Temperature],
+		"wind_speed":    weatherUnitSymbols[u.WindSpeed],
+		"precipitation": weatherUnitSymbols[u.Precipitation],
+		"visibility":    weatherUnitSymbols[u.Visibility],
+		"pressure":      weatherUnitSymbols[u.Pressure],
+	}
+}
+
+// weatherLocation is the place a weather request resolved to, along with the
+// other geocoding results when its name alone was not enough to tell
+type weatherLocation struct {
+	geoLocation
+	Candidates []geoLocation
+	Ambiguous  bool
+}
+
+// resolveWeatherLocation takes explicit coordinates, a geocoding id from a
+// previous candidates list or a free-text location. The text may be narrowed
+// down with a region after a comma, like "Paris, Texas" or "Springfield, IL".
+func resolveWeatherLocation(query url.Values, lang string) (*weatherLocation, error) {
+	if lat, lon := query.Get("lat"), query.Get("lon"); lat != "" || lon != "" {
+		point, err := parseMapPoint(lat + "," + lon)
+		if err != nil {
+			return nil, err
+		}
+		return &weatherLocation{geoLocation: reverseGeocode(point.Lat, point.Lon, lang)}, nil
+	}
+
+	if id := query.Get("location_id"); id != "" {
+		if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid 'location_id' query parameter %q", id)
+		}
+		var loc geoLocation
+		params := url.Values{"id": {id}, "language": {lang}}
+		// open-meteo can answer unknown ids with a 400 rather than a 404
+		if err := fetchJSON("https://geocoding-api.open-meteo.com/v1/get?"+params.Encode(), &loc); err != nil {
+			var statusErr *statusCodeError
+			if errors.As(err, &statusErr) && (statusErr.code == http.StatusNotFound || statusErr.code == http.StatusBadRequest) {
+				return nil, errLocationNotFound
+			}
+			return nil, errGeocodingFailed
+		}
+		if loc.Name == "" {
+			return nil, errLocationNotFound
+		}
+		return &weatherLocation{geoLocation: loc}, nil
+	}
+
+	location := strings.TrimSpace(query.Get("location"))
+	if location == "" {
+		return nil, errors.New("missing query parameter 'location'")
+	}
+
+	name, region, _ := strings.Cut(location, ",")
+	region = strings.TrimSpace(region)
+	count := geoCandidateCount
+	if region != "" {
+		count = geoRegionSearchCount
+	}
+	params := url.Values{
+		"name":     {strings.TrimSpace(name)},
+		"count":    {strconv.Itoa(count)},
+		"language": {lang},
+	}
+	var geo geoResponse
+	if err := fetchJSON("https://geocoding-api.open-meteo.com/v1/search?"+params.Encode(), &geo); err != nil {
+		return nil, errGeocodingFailed
+	}
+
+	return pickGeoCandidate(geo.Results, region)
+}
+
+// pickGeoCandidate narrows the geocoding results down to the ones in region,
+// if any, and flags the pick as ambiguous when another place of the same name
+// is within an order of magnitude of its population
+func pickGeoCandidate(results []geoLocation, region string) (*weatherLocation, error) {
+	if region != "" {
+		var matched []geoLocation
+		for _, loc := range results {
+			if geoInRegion(loc, region) {
+				matched = append(matched, loc)
+			}
+		}
+		results = matched
+	}
+	if len(results) == 0 {
+		return nil, errLocationNotFound
+	}
+
+	best := results[0]
+	for _, loc := range results[1:] {
+		if strings.EqualFold(loc.Name, best.Name) && loc.Population > best.Population {
+			best = loc
+		}
+	}
+
+	ambiguous := false
+	for _, loc := range results {
+		if loc.ID != best.ID && strings.EqualFold(loc.Name, best.Name) && loc.Population*10 >= best.Population {
+			ambiguous = true
+			break
+		}
+	}
+
+	if len(results) > geoCandidateCount {
+		results = results[:geoCandidateCount]
+	}
+	return &weatherLocation{geoLocation: best, Candidates: results, Ambiguous: ambiguous}, nil
+}
+
+func geoInRegion(loc geoLocation, region string) bool {
+	for _, field := range []string{loc.Country, loc.CountryCode, loc.Admin1, loc.Admin2} {
+		if field != "" && strings.HasPrefix(strings.ToLower(field), strings.ToLower(region)) {
+			return true
+		}
+	}
+	// us state abbreviations are what people type, geocoding only knows the
+	// full names
+	if state, ok := usStateAbbreviations[strings.ToUpper(region)]; ok {
+		return loc.CountryCode == "US" && loc.Admin1 == state
+	}
+	return false
+}
+
+var usStateAbbreviations = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+	"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "FL": "Florida", "GA": "Georgia",
+	"HI": "Hawaii", "ID": "Idaho", "IL": "Illinois", "IN": "Indiana", "IA": "Iowa",
+	"KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana", "ME": "Maine", "MD": "Maryland",
+	"MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi", "MO": "Missouri",
+	"MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey",
+	"NM": "New Mexico", "NY": "New York", "NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio",
+	"OK": "Oklahoma", "OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina",
+	"SD": "South Dakota", "TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont",
+	"VA": "Virginia", "WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+	"DC": "District of Columbia",
+}
+
+// reverseGeocode names a coordinate pair, falling back to the coordinates
+// themselves since the weather does not depend on it
+func reverseGeocode(lat, lon float64, lang string) geoLocation {
+	loc := geoLocation{
+		Latitude:  lat,
+		Longitude: lon,
+		Name:      fmt.Sprintf("%.4f, %.4f", lat, lon),
+	}
+
+	var place struct {
+		Name    string            `json:"name"`
+		Address map[string]string `json:"address"`
+	}
+	params := url.Values{
+		"lat":             {strconv.FormatFloat(lat, 'f', 6, 64)},
+		"lon":             {strconv.FormatFloat(lon, 'f', 6, 64)},
+		"zoom":            {"10"},
+		"addressdetails":  {"1"},
+		"accept-language": {lang},
+	}
+	if err := fetchJSONWithHeaders(nominatimURL("reverse", params), osmHeaders, &place); err != nil {
+		return loc
+	}
+
+	if name := firstTag(place.Address, "city", "town", "village", "municipality", "county"); name != "" {
+		loc.Name = name
+	} else if place.Name != "" {
+		loc.Name = place.Name
+	}
+	loc.Country = place.Address["country"]
+	loc.CountryCode = strings.ToUpper(place.Address["country_code"])
+	loc.Admin1 = place.Address["state"]
+	return loc
+}
+
+func describeGeoLocation(loc geoLocation) map[string]interface{} {
+	place := map[string]interface{}{
+		"name":         loc.Name,
+		"country":      loc.Country,
+		"country_code": loc.CountryCode,
+		"admin1":       loc.Admin1,
+		"latitude":     loc.Latitude,
+		"longitude":    loc.Longitude,
+	}
+	if loc.ID != 0 {
+		place["id"] = loc.ID
+	}
+	if loc.Admin2 != "" {
+		place["admin2"] = loc.Admin2
+	}
+	if loc.Population != 0 {
+		place["population"] = loc.Population
+	}
+	return place
+}
+
+func fetchWeather(loc geoLocation, opts weatherOptions) (weatherResponse, error) {
+	params := url.Values{
+		"latitude":           {strconv.FormatFloat(loc.Latitude, 'f', 4, 64)},
+		"longitude":          {strconv.FormatFloat(loc.Longitude, 'f', 4, 64)},
+		"current":            {"temperature_2m,weather_code,relative_humidity_2m,apparent_temperature,wind_speed_10m,wind_gusts_10m,visibility,pressure_msl"},
+		"daily":              {"weather_code,temperature_2m_max,temperature_2m_min,sunrise,sunset,precipitation_sum,precipitation_probability_max"},
+		"timezone":           {"auto"},
+		"temperature_unit":   {opts.Units.apiTemperatureUnit()},
+		"wind_speed_unit":    {opts.Units.WindSpeed},
+		"precipitation_unit": {opts.Units.Precipitation},
+	}
+	if opts.Hours > 0 {
+		params.Set("hourly", "temperature_2m,weather_code,precipitation_probability,precipitation,wind_gusts_10m,uv_index")
+		params.Set("forecast_hours", strconv.Itoa(opts.Hours))
+	}
+
+	var weather weatherResponse
+	if err := fetchJSON("https://api.open-meteo.com/v1/forecast?"+params.Encode(), &weather); err != nil {
+		return weather, err
+	}
+	opts.Units.convert(&weather)
+	return weather, nil
+}
+
+func SearchWeather(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	opts, err := parseWeatherOptions(r.URL.Query())
+	if err != nil {
+		rw.writeError(StatusError, err.Error())
+		return
+	}
+
+	loc, err := resolveWeatherLocation(r.URL.Query(), opts.Lang)
+	if err != nil {
+		writeLocationError(rw, err)
+		return
+	}
+
+	// alerts and air quality come from other services, fetch them while the
+	// forecast loads. alerts outlive the request so a slow cold fetch still
+	// fills the caches.
+	alertsDone := make(chan []weatherAlert, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), weatherAlertTimeout)
+		defer cancel()
+		alertsDone <- fetchWeatherAlerts(ctx, loc.geoLocation, opts.Lang)
+	}()
+	airQualityDone := make(chan *airQualityResponse, 1)
+	go func() {
+		if !opts.AirQuality {
+			airQualityDone <- nil
+			return
+		}
+		aq, err := fetchAirQuality(loc.geoLocation, defaultAirQualityDays)
+		if err != nil {
+			log.Printf("failed to fetch air quality: %v", err)
+		}
+		airQualityDone <- aq
+	}()
+
+	weather, err := fetchWeather(loc.geoLocation, opts)
+	if err != nil {
+		rw.writeError(StatusError, "failed to fetch weather")
+		return
+	}
+
+	var alerts []weatherAlert
+	alertsPending := false
+	select {
+	case alerts = <-alertsDone:
+	case <-time.After(weatherAlertGrace):
+		alertsPending = true
+	}
+
+	result := buildWeatherResult(loc.geoLocation, weather, alerts, opts)
+	if alertsPending {
+		result["warnings_pending"] = true
+	}
+	if aq := <-airQualityDone; aq != nil {
+		result["air_quality"] = buildAirQuality(aq, opts.Lang)
+	}
+
+	response := map[string]interface{}{
+		"status": StatusSuccess,
+		"result": result,
+	}
+	loc.addCandidates(response)
+	rw.write(response)
+}
+
+func writeLocationError(rw *responseWriter, err error) {
+	if errors.Is(err, errLocationNotFound) {
+		rw.writeError(StatusNotFound, err.Error())
+	} else {
+		rw.writeError(StatusError, err.Error())
+	}
+}
+
+// addCandidates lists the other places a location name could have meant
+func (l *weatherLocation) addCandidates(response map[string]interface{}) {
+	if len(l.Candidates) < 2 {
+		return
+	}
+	candidates := make([]interface{}, 0, len(l.Candidates))
+	for _, candidate := range l.Candidates {
+		candidates = append(candidates, describeGeoLocation(candidate))
+	}
+	response["candidates"] = candidates
+	response["ambiguous"] = l.Ambiguous
+}
+
+func buildWeatherResult(loc geoLocation, weather weatherResponse, alerts []weatherAlert, opts weatherOptions) map[string]interface{} {
+	daily := weather.Daily
+	current := weather.Current
+	tz := weather.location()
+
+	return map[string]interface{}{
+		"location": loc.Name,
+		"place":    describeGeoLocation(loc),
+		"timezone": weather.openMeteoTimezone.describe(),
+		"units":    opts.Units.describe(),
+		"current": map[string]interface{}{
+			"time": parseTime(current.Time, tz),
+			"icon": map[string]interface{}{
+				"id": current.WeatherCode,
+			},
+			"temperature": map[string]interface{}{
+				"current":    current.Temperature,
+				"feels_like": current.ApparentTemp,
+				"max":        safeFloatIndex(daily.TempMax, 0),
+				"min":        safeFloatIndex(daily.TempMin, 0),
+			},
+			"condition": map[string]interface{}{
+				"label": conditionLabel(opts.Lang, current.WeatherCode),
+			},
+			"wind": map[string]interface{}{
+				"speed": current.WindSpeed,
+				"gusts": current.WindGusts,
+			},
+			"humidity":   current.RelativeHumidity,
+			"visibility": current.Visibility,
+			"pressure":   current.Pressure,
+			"sun": map[string]interface{}{
+				"sunrise": parseTime(safeStringIndex(daily.Sunrise, 0), tz),
+				"sunset":  parseTime(safeStringIndex(daily.Sunset, 0), tz),
+			},
+		},
+		"hourly":   buildHourlyForecast(weather.Hourly, tz, opts),
+		"forecast": buildForecast(daily, tz, opts),
+		"warnings": buildWeatherAlerts(alerts),
+	}
+}
+
+func buildHourlyForecast(hourly weatherHourly, tz *time.Location, opts weatherOptions) []interface{} {
+	forecast := []interface{}{}
+	for i := 0; i < opts.Hours && i < len(hourly.Time); i++ {
+		code := safeIntIndex(hourly.WeatherCode, i)
+
+		forecast = append(forecast, map[string]interface{}{
+			"time": parseTime(hourly.Time[i], tz),
+			"icon": map[string]interface{}{
+				"id": code,
+			},
+			"condition": map[string]interface{}{
+				"label": conditionLabelPtr(opts.Lang, code),
+			},
+			"temperature": safeFloatIndex(hourly.Temperature, i),
+			"precipitation": map[string]interface{}{
+				"probability": safeIntIndex(hourly.PrecipitationProbability, i),
+				"amount":      safeFloatIndex(hourly.Precipitation, i),
+			},
+			"wind": map[string]interface{}{
+				"gusts": safeFloatIndex(hourly.WindGusts, i),
+			},
+			"uv_index": safeFloatIndex(hourly.UVIndex, i),
+		})
+	}
+	return forecast
+}
+
+// buildForecast labels the days relative to the current date at the location,
+// not the server's
+func buildForecast(daily weatherDaily, tz *time.Location, opts weatherOptions) []interface{} {
+	var forecast []interface{}
+	now := time.Now().In(tz)
+
+	for i := 0; i < 7 && i < len(daily.Time); i++ {
+		t, dayName, ok := forecastDay(daily.Time[i], now, opts.Lang)
+		if !ok {
+			continue
+		}
+
+		code := safeIntIndex(daily.WeatherCode, i)
+
+		forecast = append(forecast, map[string]interface{}{
+			"day":       dayName,
+			"date":      daily.Time[i],
+			"timestamp": t.UnixMilli(),
+			"icon": map[string]interface{}{
+				"id": code,
+			},
+			"condition": map[string]interface{}{
+				"label": conditionLabelPtr(opts.Lang, code),
+			},
+			"temperature": map[string]interface{}{
+				"max": safeFloatIndex(daily.TempMax, i),
+				"min": safeFloatIndex(daily.TempMin, i),
+			},
+			"precipitation": map[string]interface{}{
+				"sum":         safeFloatIndex(daily.PrecipitationSum, i),
+				"probability": safeIntIndex(daily.PrecipitationProbability, i),
+			},
+		})
+	}
+	return forecast
+}
+
+// forecastDay parses a forecast date in now's location and names it
+func forecastDay(date string, now time.Time, lang string) (time.Time, string, bool) {
+	t, err := time.ParseInLocation("2006-01-02", date, now.Location())
+	if err != nil {
+		return t, "", false
+	}
+
+	switch {
+	case sameDay(t, now):
+		return t, relativeDayName(lang, 0), true
+	case sameDay(t, now.AddDate(0, 0, 1)):
+		return t, relativeDayName(lang, 1), true
+	}
+	return t, weekdayName(lang, t.Weekday()), true
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
+
+func safeFloatIndex(slice []float64, index int) *float64 {
+	if index >= 0 && index < len(slice) {
+		return &slice[index]
+	}
+	return nil
+}
+
+func safeIntIndex(slice []int, index int) *int {
+	if index >= 0 && index < len(slice) {
+		return &slice[index]
+	}
+	return nil
+}
+
+func safeStringIndex(slice []string, index int) string {
+	if index >= 0 && index < len(slice) {
+		return slice[index]
+	}
+	return ""
+}
+
+// parseTime reads an open-meteo local time as a time in tz
+func parseTime(s string, tz *time.Location) int64 {
+	t, err := time.ParseInLocation("2006-01-02T15:04", s, tz)
+	if err != nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
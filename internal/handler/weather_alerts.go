@@ -0,0 +1,840 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html/charset"
+)
+
+// weather alerts are CAP (common alerting protocol) messages. the NWS serves
+// them as geojson filtered by point, meteoalarm and most other agencies as
+// atom or rss feeds that link to the CAP documents or inline their fields.
+
+const (
+	weatherAlertTimeout = 8 * time.Second
+	// weatherAlertGrace is how long a forecast waits for alerts that are not
+	// ready yet, they keep loading into the caches for the next request
+	weatherAlertGrace        = time.Second
+	weatherAlertMaxBytes     = 10 << 20
+	weatherAlertMaxDocuments = 60
+	weatherAlertWorkers      = 8
+)
+
+var (
+	weatherAlertCache = newTTLCache[[]weatherAlert](5*time.Minute, 200)
+	capDocumentCache  = newTTLCache[*capAlert](time.Hour, 5000)
+)
+
+var capSeverityRank = map[string]int{"extreme": 4, "severe": 3, "moderate": 2, "minor": 1}
+
+type weatherAlertCircle struct {
+	Center   mapPoint
+	RadiusKm float64
+}
+
+type weatherAlertArea struct {
+	Description string
+	Polygons    [][]mapPoint
+	Circles     []weatherAlertCircle
+}
+
+func (a weatherAlertArea) hasGeometry() bool {
+	return len(a.Polygons) > 0 || len(a.Circles) > 0
+}
+
+func (a weatherAlertArea) contains(p mapPoint) bool {
+	for _, polygon := range a.Polygons {
+		if pointInPolygon(p, polygon) {
+			return true
+		}
+	}
+	for _, c := range a.Circles {
+		if distanceMeters(p.Lat, p.Lon, c.Center.Lat, c.Center.Lon) <= c.RadiusKm*1000 {
+			return true
+		}
+	}
+	return false
+}
+
+type weatherAlert struct {
+	ID          string
+	Source      string
+	Sender      string
+	Event       string
+	Headline    string
+	Description string
+	Instruction string
+	Severity    string
+	Urgency     string
+	Certainty   string
+	Effective   time.Time
+	Expires     time.Time
+	Areas       []weatherAlertArea
+}
+
+// matchGeometry tests the point against the alert's polygons and circles.
+// hasGeometry is false when the alert only names its areas.
+func (a weatherAlert) matchGeometry(p mapPoint) (matched, hasGeometry bool) {
+	for _, area := range a.Areas {
+		if !area.hasGeometry() {
+			continue
+		}
+		hasGeometry = true
+		if area.contains(p) {
+			return true, true
+		}
+	}
+	return false, hasGeometry
+}
+
+// appliesTo matches the alert by geometry, or by area names when the alert
+// has none and matchNames is set. plenty of agencies only send geocodes of
+// their own districts, the names are the only thing we can compare.
+func (a weatherAlert) appliesTo(loc geoLocation, matchNames bool) bool {
+	matched, hasGeometry := a.matchGeometry(mapPoint{Lat: loc.Latitude, Lon: loc.Longitude})
+	if hasGeometry || !matchNames {
+		return matched
+	}
+
+	names := map[string]bool{}
+	for _, name := range []string{loc.Name, loc.Admin2} {
+		if name := normalizeAreaName(name); name != "" {
+			names[name] = true
+		}
+	}
+	for _, area := range a.Areas {
+		// descriptions list several areas, each has to match as a whole so
+		// "Roma" doesn't match "Emilia-Romagna"
+		for _, part := range strings.FieldsFunc(area.Description, func(r rune) bool { return r == ',' || r == ';' }) {
+			if names[normalizeAreaName(part)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func normalizeAreaName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// pointInPolygon is the usual ray casting test, longitude is x
+func pointInPolygon(p mapPoint, polygon []mapPoint) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+type weatherAlertSource interface {
+	name() string
+	covers(loc geoLocation) bool
+	alerts(ctx context.Context, loc geoLocation, lang string) ([]weatherAlert, error)
+}
+
+func weatherAlertSources() []weatherAlertSource {
+	names := os.Getenv("WEATHER_ALERT_SOURCES")
+	if names == "" {
+		names = "nws,meteoalarm,feeds"
+	}
+
+	var sources []weatherAlertSource
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "nws":
+			sources = append(sources, &nwsAlertSource{})
+		case "meteoalarm":
+			sources = append(sources, &meteoalarmSource{})
+		case "feeds":
+			for _, entry := range strings.Split(os.Getenv("WEATHER_ALERT_FEEDS"), ",") {
+				if source := parseCAPFeedEntry(strings.TrimSpace(entry)); source != nil {
+					sources = append(sources, source)
+				}
+			}
+		}
+	}
+	return sources
+}
+
+// parseCAPFeedEntry reads a WEATHER_ALERT_FEEDS entry, a feed url optionally
+// prefixed with the country codes it covers, like "CA+US=https://...".
+func parseCAPFeedEntry(entry string) *capFeedSource {
+	if entry == "" {
+		return nil
+	}
+	source := &capFeedSource{label: "feed", url: entry}
+	if codes, feedURL, ok := strings.Cut(entry, "="); ok && !strings.Contains(codes, "/") {
+		source.url = strings.TrimSpace(feedURL)
+		source.countries = map[string]bool{}
+		for _, code := range strings.Split(codes, "+") {
+			source.countries[strings.ToUpper(strings.TrimSpace(code))] = true
+		}
+	}
+	return source
+}
+
+// fetchWeatherAlerts asks every source covering the location concurrently
+// and returns the active alerts, most severe first. sources failing only
+// lose their own alerts.
+func fetchWeatherAlerts(ctx context.Context, loc geoLocation, lang string) []weatherAlert {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		all []weatherAlert
+	)
+	for _, source := range weatherAlertSources() {
+		if !source.covers(loc) {
+			continue
+		}
+		wg.Add(1)
+		go func(source weatherAlertSource) {
+			defer wg.Done()
+			alerts, err := source.alerts(ctx, loc, lang)
+			if err != nil {
+				log.Printf("weather alert source %s failed: %v", source.name(), err)
+				return
+			}
+			mu.Lock()
+			all = append(all, alerts...)
+			mu.Unlock()
+		}(source)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	seen := map[string]bool{}
+	var alerts []weatherAlert
+	for _, alert := range all {
+		key := alert.ID
+		if key == "" {
+			key = alert.Event + "\x00" + alert.Headline
+		}
+		if seen[key] || (!alert.Expires.IsZero() && alert.Expires.Before(now)) {
+			continue
+		}
+		seen[key] = true
+		alerts = append(alerts, alert)
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		ri, rj := capSeverityRank[alerts[i].Severity], capSeverityRank[alerts[j].Severity]
+		if ri != rj {
+			return ri > rj
+		}
+		return alerts[i].Effective.Before(alerts[j].Effective)
+	})
+	return alerts
+}
+
+func fetchAlertDocument(ctx context.Context, docURL, accept string) ([]byte, error) {
+	headers := map[string]string{"User-Agent": osmHeaders["User-Agent"], "Accept": accept}
+	resp, err := fetchResponse(ctx, httpClient, docURL, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(io.LimitReader(resp.Body, weatherAlertMaxBytes))
+}
+
+func decodeAlertXML(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	return decoder.Decode(v)
+}
+
+func parseAlertTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func normalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, ok := capSeverityRank[s]; !ok {
+		return "unknown"
+	}
+	return s
+}
+
+// parseCAPPolygon reads a CAP polygon, space separated "lat,lon" pairs
+func parseCAPPolygon(s string) []mapPoint {
+	var polygon []mapPoint
+	for _, pair := range strings.Fields(s) {
+		point, err := parseMapPoint(pair)
+		if err != nil {
+			return nil
+		}
+		polygon = append(polygon, point)
+	}
+	if len(polygon) < 3 {
+		return nil
+	}
+	return polygon
+}
+
+// parseCAPCircle reads a CAP circle, "lat,lon radius" with the radius in km
+func parseCAPCircle(s string) (weatherAlertCircle, bool) {
+	center, radius, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return weatherAlertCircle{}, false
+	}
+	point, err := parseMapPoint(center)
+	if err != nil {
+		return weatherAlertCircle{}, false
+	}
+	km, err := strconv.ParseFloat(strings.TrimSpace(radius), 64)
+	if err != nil || km <= 0 {
+		return weatherAlertCircle{}, false
+	}
+	return weatherAlertCircle{Center: point, RadiusKm: km}, true
+}
+
+type capArea struct {
+	AreaDesc string   `xml:"areaDesc"`
+	Polygons []string `xml:"polygon"`
+	Circles  []string `xml:"circle"`
+}
+
+type capInfo struct {
+	Language    string    `xml:"language"`
+	Event       string    `xml:"event"`
+	Urgency     string    `xml:"urgency"`
+	Severity    string    `xml:"severity"`
+	Certainty   string    `xml:"certainty"`
+	Effective   string    `xml:"effective"`
+	Onset       string    `xml:"onset"`
+	Expires     string    `xml:"expires"`
+	SenderName  string    `xml:"senderName"`
+	Headline    string    `xml:"headline"`
+	Description string    `xml:"description"`
+	Instruction string    `xml:"instruction"`
+	Areas       []capArea `xml:"area"`
+}
+
+type capAlert struct {
+	XMLName    xml.Name
+	Identifier string    `xml:"identifier"`
+	Sender     string    `xml:"sender"`
+	Sent       string    `xml:"sent"`
+	Status     string    `xml:"status"`
+	MsgType    string    `xml:"msgType"`
+	Infos      []capInfo `xml:"info"`
+}
+
+// pickInfo returns the info block in the requested language, falling back to
+// english and then to whatever came first. multilingual agencies send one
+// block per language.
+func (c *capAlert) pickInfo(lang string) *capInfo {
+	if len(c.Infos) == 0 {
+		return nil
+	}
+	for _, want := range []string{lang, "en"} {
+		for i := range c.Infos {
+			base, _, _ := strings.Cut(strings.ToLower(c.Infos[i].Language), "-")
+			if base == want {
+				return &c.Infos[i]
+			}
+		}
+	}
+	return &c.Infos[0]
+}
+
+func (c *capAlert) toWeatherAlert(source, lang string) (weatherAlert, bool) {
+	// tests, exercises and cancellations are not something to show users
+	if (c.Status != "" && !strings.EqualFold(c.Status, "Actual")) || strings.EqualFold(c.MsgType, "Cancel") {
+		return weatherAlert{}, false
+	}
+	info := c.pickInfo(lang)
+	if info == nil {
+		return weatherAlert{}, false
+	}
+
+	alert := weatherAlert{
+		ID:          c.Identifier,
+		Source:      source,
+		Sender:      strings.TrimSpace(info.SenderName),
+		Event:       strings.TrimSpace(info.Event),
+		Headline:    strings.TrimSpace(info.Headline),
+		Description: strings.TrimSpace(info.Description),
+		Instruction: strings.TrimSpace(info.Instruction),
+		Severity:    normalizeSeverity(info.Severity),
+		Urgency:     strings.ToLower(info.Urgency),
+		Certainty:   strings.ToLower(info.Certainty),
+		Effective:   parseAlertTime(info.Onset),
+		Expires:     parseAlertTime(info.Expires),
+	}
+	if alert.Sender == "" {
+		alert.Sender = c.Sender
+	}
+	if alert.Effective.IsZero() {
+		alert.Effective = parseAlertTime(info.Effective)
+	}
+	if alert.Effective.IsZero() {
+		alert.Effective = parseAlertTime(c.Sent)
+	}
+	for _, a := range info.Areas {
+		alert.Areas = append(alert.Areas, capAreaToWeatherArea(a))
+	}
+	return alert, true
+}
+
+func capAreaToWeatherArea(a capArea) weatherAlertArea {
+	area := weatherAlertArea{Description: strings.TrimSpace(a.AreaDesc)}
+	for _, raw := range a.Polygons {
+		if polygon := parseCAPPolygon(raw); polygon != nil {
+			area.Polygons = append(area.Polygons, polygon)
+		}
+	}
+	for _, raw := range a.Circles {
+		if circle, ok := parseCAPCircle(raw); ok {
+			area.Circles = append(area.Circles, circle)
+		}
+	}
+	return area
+}
+
+// capFeedEntry is an atom entry or rss item of an alert feed. besides the
+// link to the CAP document some feeds copy the CAP fields into the entry.
+type capFeedEntry struct {
+	ID      string `xml:"id"`
+	GUID    string `xml:"guid"`
+	Title   string `xml:"title"`
+	Summary string `xml:"summary"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+		Type string `xml:"type,attr"`
+		Text string `xml:",chardata"`
+	} `xml:"link"`
+	Identifier  string   `xml:"identifier"`
+	Status      string   `xml:"status"`
+	MsgType     string   `xml:"msgType"`
+	Event       string   `xml:"event"`
+	Severity    string   `xml:"severity"`
+	Urgency     string   `xml:"urgency"`
+	Certainty   string   `xml:"certainty"`
+	Effective   string   `xml:"effective"`
+	Onset       string   `xml:"onset"`
+	Expires     string   `xml:"expires"`
+	AreaDesc    string   `xml:"areaDesc"`
+	Polygons    []string `xml:"polygon"`
+	Description string   `xml:"description"`
+}
+
+type capFeedDocument struct {
+	Entries []capFeedEntry `xml:"entry"`
+	Items   []capFeedEntry `xml:"channel>item"`
+}
+
+// capLink finds the entry's CAP document. entries without inline CAP fields
+// are assumed to link to nothing else.
+func (e capFeedEntry) capLink() string {
+	for _, link := range e.Links {
+		if strings.Contains(link.Type, "cap") && link.Href != "" {
+			return link.Href
+		}
+	}
+	if e.Event != "" {
+		return ""
+	}
+	for _, link := range e.Links {
+		if href := strings.TrimSpace(link.Href + link.Text); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+func (e capFeedEntry) inlineAlert() *capAlert {
+	if e.Event == "" {
+		return nil
+	}
+	id := e.Identifier
+	if id == "" {
+		id = firstNonEmpty(e.ID, e.GUID)
+	}
+	return &capAlert{
+		Identifier: id,
+		Status:     e.Status,
+		MsgType:    e.MsgType,
+		Infos: []capInfo{{
+			Event:       e.Event,
+			Severity:    e.Severity,
+			Urgency:     e.Urgency,
+			Certainty:   e.Certainty,
+			Effective:   e.Effective,
+			Onset:       e.Onset,
+			Expires:     e.Expires,
+			Headline:    cleanFeedText(e.Title),
+			Description: cleanFeedText(firstNonEmpty(e.Summary, e.Description)),
+			Areas:       []capArea{{AreaDesc: e.AreaDesc, Polygons: e.Polygons}},
+		}},
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func fetchCAPDocument(ctx context.Context, docURL string) (*capAlert, error) {
+	if cached, ok := capDocumentCache.get(docURL); ok {
+		return cached, nil
+	}
+	data, err := fetchAlertDocument(ctx, docURL, "application/cap+xml, application/xml;q=0.9")
+	if err != nil {
+		return nil, err
+	}
+	var doc capAlert
+	if err := decodeAlertXML(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.XMLName.Local != "alert" {
+		return nil, fmt.Errorf("%s is not a CAP alert", docURL)
+	}
+	capDocumentCache.set(docURL, &doc)
+	return &doc, nil
+}
+
+// loadCAPFeed returns every alert of a feed, or of a single CAP document.
+// linked documents are fetched concurrently and preferred over the inline
+// fields, which often lack the description and polygons.
+func loadCAPFeed(ctx context.Context, source, feedURL, lang string) ([]weatherAlert, error) {
+	cacheKey := feedURL + "\x00" + lang
+	if cached, ok := weatherAlertCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	data, err := fetchAlertDocument(ctx, feedURL, "application/atom+xml, application/rss+xml, application/cap+xml, application/xml;q=0.9")
+	if err != nil {
+		return nil, err
+	}
+
+	var root capAlert
+	if err := decodeAlertXML(data, &root); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	if root.XMLName.Local == "alert" {
+		var alerts []weatherAlert
+		if alert, ok := root.toWeatherAlert(source, lang); ok {
+			alerts = append(alerts, alert)
+		}
+		weatherAlertCache.set(cacheKey, alerts)
+		return alerts, nil
+	}
+
+	var feed capFeedDocument
+	if err := decodeAlertXML(data, &feed); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	entries := append(feed.Entries, feed.Items...)
+
+	now := time.Now()
+	docs := make([]*capAlert, len(entries))
+	sem := make(chan struct{}, weatherAlertWorkers)
+	var (
+		wg      sync.WaitGroup
+		failed  atomic.Bool
+		fetched int
+	)
+	for i, entry := range entries {
+		docs[i] = entry.inlineAlert()
+		// expired entries are still listed until the feed catches up
+		if expires := parseAlertTime(entry.Expires); !expires.IsZero() && expires.Before(now) {
+			continue
+		}
+		link := entry.capLink()
+		if link == "" || fetched >= weatherAlertMaxDocuments {
+			continue
+		}
+		fetched++
+
+		wg.Add(1)
+		go func(i int, link string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			doc, err := fetchCAPDocument(ctx, link)
+			if err != nil {
+				failed.Store(true)
+				return
+			}
+			docs[i] = doc
+		}(i, link)
+	}
+	wg.Wait()
+
+	var alerts []weatherAlert
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		if alert, ok := doc.toWeatherAlert(source, lang); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	// a feed missing documents, say after the timeout, is retried next time.
+	// the documents that did load are cached on their own.
+	if !failed.Load() {
+		weatherAlertCache.set(cacheKey, alerts)
+	}
+	return alerts, nil
+}
+
+// capFeedSource is an alert feed from WEATHER_ALERT_FEEDS
+type capFeedSource struct {
+	label     string
+	url       string
+	countries map[string]bool
+	// matchNames falls back to area names for alerts without geometry
+	matchNames bool
+}
+
+func (s *capFeedSource) name() string {
+	return s.label
+}
+
+func (s *capFeedSource) covers(loc geoLocation) bool {
+	return len(s.countries) == 0 || s.countries[loc.CountryCode]
+}
+
+func (s *capFeedSource) alerts(ctx context.Context, loc geoLocation, lang string) ([]weatherAlert, error) {
+	all, err := loadCAPFeed(ctx, s.label, s.url, lang)
+	if err != nil {
+		return nil, err
+	}
+	var alerts []weatherAlert
+	for _, alert := range all {
+		if alert.appliesTo(loc, s.matchNames) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// meteoalarmFeeds maps country codes to meteoalarm's per country feed names
+var meteoalarmFeeds = map[string]string{
+	"AT": "austria", "BA": "bosnia-herzegovina", "BE": "belgium", "BG": "bulgaria",
+	"CH": "switzerland", "CY": "cyprus", "CZ": "czechia", "DE": "germany",
+	"DK": "denmark", "EE": "estonia", "ES": "spain", "FI": "finland",
+	"FR": "france", "GB": "united-kingdom", "GR": "greece", "HR": "croatia",
+	"HU": "hungary", "IE": "ireland", "IL": "israel", "IS": "iceland",
+	"IT": "italy", "LT": "lithuania", "LU": "luxembourg", "LV": "latvia",
+	"MD": "moldova", "ME": "montenegro", "MK": "republic-of-north-macedonia", "MT": "malta",
+	"NL": "netherlands", "NO": "norway", "PL": "poland", "PT": "portugal",
+	"RO": "romania", "RS": "serbia", "SE": "sweden", "SI": "slovenia",
+	"SK": "slovakia", "UA": "ukraine",
+}
+
+type meteoalarmSource struct{}
+
+func (m *meteoalarmSource) name() string {
+	return "meteoalarm"
+}
+
+func (m *meteoalarmSource) covers(loc geoLocation) bool {
+	return meteoalarmFeeds[loc.CountryCode] != ""
+}
+
+func (m *meteoalarmSource) alerts(ctx context.Context, loc geoLocation, lang string) ([]weatherAlert, error) {
+	feed := &capFeedSource{
+		label:      "meteoalarm",
+		url:        "https://feeds.meteoalarm.org/feeds/meteoalarm-legacy-atom-" + meteoalarmFeeds[loc.CountryCode],
+		matchNames: true,
+	}
+	return feed.alerts(ctx, loc, lang)
+}
+
+// nwsCountries are the US and the territories the NWS issues alerts for
+var nwsCountries = map[string]bool{"US": true, "PR": true, "GU": true, "VI": true, "AS": true, "MP": true}
+
+type nwsAlertResponse struct {
+	Features []struct {
+		Geometry *struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties struct {
+			ID          string `json:"id"`
+			AreaDesc    string `json:"areaDesc"`
+			SenderName  string `json:"senderName"`
+			Status      string `json:"status"`
+			MessageType string `json:"messageType"`
+			Event       string `json:"event"`
+			Headline    string `json:"headline"`
+			Description string `json:"description"`
+			Instruction string `json:"instruction"`
+			Severity    string `json:"severity"`
+			Certainty   string `json:"certainty"`
+			Urgency     string `json:"urgency"`
+			Sent        string `json:"sent"`
+			Effective   string `json:"effective"`
+			Onset       string `json:"onset"`
+			Expires     string `json:"expires"`
+			Ends        string `json:"ends"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+type nwsAlertSource struct{}
+
+func (n *nwsAlertSource) name() string {
+	return "nws"
+}
+
+func (n *nwsAlertSource) covers(loc geoLocation) bool {
+	return nwsCountries[loc.CountryCode]
+}
+
+// alerts uses the point filter of the NWS api, which also matches alerts
+// issued for forecast zones and counties. those carry no geometry, the
+// others are checked against their polygon again.
+func (n *nwsAlertSource) alerts(ctx context.Context, loc geoLocation, lang string) ([]weatherAlert, error) {
+	alertsURL := fmt.Sprintf("https://api.weather.gov/alerts/active?point=%.4f,%.4f", loc.Latitude, loc.Longitude)
+	if cached, ok := weatherAlertCache.get(alertsURL); ok {
+		return cached, nil
+	}
+
+	data, err := fetchAlertDocument(ctx, alertsURL, "application/geo+json")
+	if err != nil {
+		return nil, err
+	}
+	var resp nwsAlertResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	point := mapPoint{Lat: loc.Latitude, Lon: loc.Longitude}
+	var alerts []weatherAlert
+	for _, feature := range resp.Features {
+		p := feature.Properties
+		if !strings.EqualFold(p.Status, "Actual") || strings.EqualFold(p.MessageType, "Cancel") {
+			continue
+		}
+
+		alert := weatherAlert{
+			ID:          p.ID,
+			Source:      "nws",
+			Sender:      p.SenderName,
+			Event:       p.Event,
+			Headline:    p.Headline,
+			Description: strings.TrimSpace(p.Description),
+			Instruction: strings.TrimSpace(p.Instruction),
+			Severity:    normalizeSeverity(p.Severity),
+			Urgency:     strings.ToLower(p.Urgency),
+			Certainty:   strings.ToLower(p.Certainty),
+			Effective:   parseAlertTime(firstNonEmpty(p.Onset, p.Effective, p.Sent)),
+			Expires:     parseAlertTime(firstNonEmpty(p.Ends, p.Expires)),
+		}
+		area := weatherAlertArea{Description: p.AreaDesc}
+		if feature.Geometry != nil {
+			area.Polygons = geoJSONPolygons(feature.Geometry.Type, feature.Geometry.Coordinates)
+		}
+		alert.Areas = []weatherAlertArea{area}
+
+		if matched, hasGeometry := alert.matchGeometry(point); hasGeometry && !matched {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+
+	weatherAlertCache.set(alertsURL, alerts)
+	return alerts, nil
+}
+
+// geoJSONPolygons returns the outer rings of a Polygon or MultiPolygon
+func geoJSONPolygons(geometryType string, coordinates json.RawMessage) [][]mapPoint {
+	var polygons [][][][2]float64
+	switch geometryType {
+	case "Polygon":
+		var polygon [][][2]float64
+		if err := json.Unmarshal(coordinates, &polygon); err != nil {
+			return nil
+		}
+		polygons = append(polygons, polygon)
+	case "MultiPolygon":
+		if err := json.Unmarshal(coordinates, &polygons); err != nil {
+			return nil
+		}
+	}
+
+	var rings [][]mapPoint
+	for _, polygon := range polygons {
+		if len(polygon) == 0 || len(polygon[0]) < 3 {
+			continue
+		}
+		ring := make([]mapPoint, 0, len(polygon[0]))
+		for _, c := range polygon[0] {
+			ring = append(ring, mapPoint{Lat: c[1], Lon: c[0]})
+		}
+		rings = append(rings, ring)
+	}
+	return rings
+}
+
+func buildWeatherAlerts(alerts []weatherAlert) []interface{} {
+	warnings := []interface{}{}
+	for _, alert := range alerts {
+		var areas []string
+		for _, area := range alert.Areas {
+			if area.Description != "" {
+				areas = append(areas, area.Description)
+			}
+		}
+
+		warnings = append(warnings, map[string]interface{}{
+			"id":          alert.ID,
+			"source":      alert.Source,
+			"sender":      alert.Sender,
+			"event":       alert.Event,
+			"headline":    alert.Headline,
+			"description": alert.Description,
+			"instruction": alert.Instruction,
+			"severity":    alert.Severity,
+			"urgency":     alert.Urgency,
+			"certainty":   alert.Certainty,
+			"effective":   alertTimestamp(alert.Effective),
+			"expires":     alertTimestamp(alert.Expires),
+			"areas":       areas,
+		})
+	}
+	return warnings
+}
+
+func alertTimestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
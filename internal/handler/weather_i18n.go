@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"strings"
+	"time"
+)
+
+// conditionLabels holds the wmo weather interpretation codes open-meteo
+// returns, per language. english is the fallback for everything else.
+var conditionLabels = map[string]map[int]string{
+	"en": {
+		0: "Clear sky", 1: "Mainly clear", 2: "Partly cloudy", 3: "Overcast",
+		45: "Fog", 48: "Depositing rime fog",
+		51: "Light drizzle", 53: "Moderate drizzle", 55: "Dense drizzle",
+		56: "Light freezing drizzle", 57: "Dense freezing drizzle",
+		61: "Slight rain", 63: "Moderate rain", 65: "Heavy rain",
+		66: "Light freezing rain", 67: "Heavy freezing rain",
+		71: "Slight snow fall", 73: "Moderate snow fall", 75: "Heavy snow fall", 77: "Snow grains",
+		80: "Slight rain showers", 81: "Moderate rain showers", 82: "Violent rain showers",
+		85: "Slight snow showers", 86: "Heavy snow showers",
+		95: "Thunderstorm", 96: "Thunderstorm with hail", 99: "Thunderstorm with heavy hail",
+	},
+	"de": {
+		0: "Klarer Himmel", 1: "Überwiegend klar", 2: "Teilweise bewölkt", 3: "Bedeckt",
+		45: "Nebel", 48: "Nebel mit Reifbildung",
+		51: "Leichter Nieselregen", 53: "Mäßiger Nieselregen", 55: "Starker Nieselregen",
+		56: "Leichter gefrierender Nieselregen", 57: "Starker gefrierender Nieselregen",
+		61: "Leichter Regen", 63: "Mäßiger Regen", 65: "Starker Regen",
+		66: "Leichter gefrierender Regen", 67: "Starker gefrierender Regen",
+		71: "Leichter Schneefall", 73: "Mäßiger Schneefall", 75: "Starker Schneefall", 77: "Schneegriesel",
+		80: "Leichte Regenschauer", 81: "Mäßige Regenschauer", 82: "Heftige Regenschauer",
+		85: "Leichte Schneeschauer", 86: "Starke Schneeschauer",
+		95: "Gewitter", 96: "Gewitter mit Hagel", 99: "Gewitter mit starkem Hagel",
+	},
+	"fr": {
+		0: "Ciel dégagé", 1: "Plutôt dégagé", 2: "Partiellement nuageux", 3: "Couvert",
+		45: "Brouillard", 48: "Brouillard givrant",
+		51: "Bruine légère", 53: "Bruine modérée", 55: "Bruine dense",
+		56: "Bruine verglaçante légère", 57: "Bruine verglaçante dense",
+		61: "Pluie faible", 63: "Pluie modérée", 65: "Pluie forte",
+		66: "Pluie verglaçante faible", 67: "Pluie verglaçante forte",
+		71: "Faibles chutes de neige", 73: "Chutes de neige modérées", 75: "Fortes chutes de neige", 77: "Neige en grains",
+		80: "Averses de pluie faibles", 81: "Averses de pluie modérées", 82: "Averses de pluie violentes",
+		85: "Averses de neige faibles", 86: "Averses de neige fortes",
+		95: "Orage", 96: "Orage avec grêle", 99: "Orage avec forte grêle",
+	},
+	"es": {
+		0: "Cielo despejado", 1: "Mayormente despejado", 2: "Parcialmente nublado", 3: "Cubierto",
+		45: "Niebla", 48: "Niebla con escarcha",
+		51: "Llovizna ligera", 53: "Llovizna moderada", 55: "Llovizna densa",
+		56: "Llovizna helada ligera", 57: "Llovizna helada densa",
+		61: "Lluvia ligera", 63: "Lluvia moderada", 65: "Lluvia intensa",
+		66: "Lluvia helada ligera", 67: "Lluvia helada intensa",
+		71: "Nevada ligera", 73: "Nevada moderada", 75: "Nevada intensa", 77: "Granos de nieve",
+		80: "Chubascos ligeros", 81: "Chubascos moderados", 82: "Chubascos violentos",
+		85: "Chubascos de nieve ligeros", 86: "Chubascos de nieve intensos",
+		95: "Tormenta", 96: "Tormenta con granizo", 99: "Tormenta con granizo fuerte",
+	},
+	"it": {
+		0: "Cielo sereno", 1: "Prevalentemente sereno", 2: "Parzialmente nuvoloso", 3: "Coperto",
+		45: "Nebbia", 48: "Nebbia con brina",
+		51: "Pioviggine leggera", 53: "Pioviggine moderata", 55: "Pioviggine intensa",
+		56: "Pioviggine gelata leggera", 57: "Pioviggine gelata intensa",
+		61: "Pioggia debole", 63: "Pioggia moderata", 65: "Pioggia forte",
+		66: "Pioggia gelata debole", 67: "Pioggia gelata forte",
+		71: "Nevicata debole", 73: "Nevicata moderata", 75: "Nevicata forte", 77: "Neve granulosa",
+		80: "Rovesci deboli", 81: "Rovesci moderati", 82: "Rovesci violenti",
+		85: "Rovesci di neve deboli", 86: "Rovesci di neve forti",
+		95: "Temporale", 96: "Temporale con grandine", 99: "Temporale con forte grandine",
+	},
+	"pt": {
+		0: "Céu limpo", 1: "Predominantemente limpo", 2: "Parcialmente nublado", 3: "Encoberto",
+		45: "Nevoeiro", 48: "Nevoeiro com geada",
+		51: "Chuvisco fraco", 53: "Chuvisco moderado", 55: "Chuvisco intenso",
+		56: "Chuvisco congelante fraco", 57: "Chuvisco congelante intenso",
+		61: "Chuva fraca", 63: "Chuva moderada", 65: "Chuva forte",
+		66: "Chuva congelante fraca", 67: "Chuva congelante forte",
+		71: "Neve fraca", 73: "Neve moderada", 75: "Neve forte", 77: "Grãos de neve",
+		80: "Aguaceiros fracos", 81: "Aguaceiros moderados", 82: "Aguaceiros violentos",
+		85: "Aguaceiros de neve fracos", 86: "Aguaceiros de neve fortes",
+		95: "Trovoada", 96: "Trovoada com granizo", 99: "Trovoada com granizo forte",
+	},
+	"nl": {
+		0: "Onbewolkt", 1: "Overwegend helder", 2: "Half bewolkt", 3: "Bewolkt",
+		45: "Mist", 48: "Rijp vormende mist",
+		51: "Lichte motregen", 53: "Matige motregen", 55: "Dichte motregen",
+		56: "Lichte onderkoelde motregen", 57: "Dichte onderkoelde motregen",
+		61: "Lichte regen", 63: "Matige regen", 65: "Zware regen",
+		66: "Lichte onderkoelde regen", 67: "Zware onderkoelde regen",
+		71: "Lichte sneeuwval", 73: "Matige sneeuwval", 75: "Zware sneeuwval", 77: "Motsneeuw",
+		80: "Lichte regenbuien", 81: "Matige regenbuien", 82: "Zware regenbuien",
+		85: "Lichte sneeuwbuien", 86: "Zware sneeuwbuien",
+		95: "Onweer", 96: "Onweer met hagel", 99: "Onweer met zware hagel",
+	},
+	"pl": {
+		0: "Bezchmurnie", 1: "Przeważnie bezchmurnie", 2: "Częściowe zachmurzenie", 3: "Pochmurno",
+		45: "Mgła", 48: "Mgła osadzająca szadź",
+		51: "Lekka mżawka", 53: "Umiarkowana mżawka", 55: "Gęsta mżawka",
+		56: "Lekka marznąca mżawka", 57: "Gęsta marznąca mżawka",
+		61: "Lekki deszcz", 63: "Umiarkowany deszcz", 65: "Silny deszcz",
+		66: "Lekki marznący deszcz", 67: "Silny marznący deszcz",
+		71: "Lekkie opady śniegu", 73: "Umiarkowane opady śniegu", 75: "Intensywne opady śniegu", 77: "Śnieg ziarnisty",
+		80: "Lekkie przelotne opady deszczu", 81: "Umiarkowane przelotne opady deszczu", 82: "Gwałtowne przelotne opady deszczu",
+		85: "Lekkie przelotne opady śniegu", 86: "Intensywne przelotne opady śniegu",
+		95: "Burza", 96: "Burza z gradem", 99: "Burza z silnym gradem",
+	},
+}
+
+// weekdayNames are the short weekday names per language, sunday first like
+// time.Weekday
+var weekdayNames = map[string][7]string{
+	"en": {"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	"de": {"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	"fr": {"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	"es": {"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	"it": {"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	"pt": {"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	"nl": {"zo", "ma", "di", "wo", "do", "vr", "za"},
+	"pl": {"nd.", "pn.", "wt.", "śr.", "czw.", "pt.", "sob."},
+}
+
+// relativeDayNames are "today" and "tomorrow" per language
+var relativeDayNames = map[string][2]string{
+	"en": {"Today", "Tomorrow"},
+	"de": {"Heute", "Morgen"},
+	"fr": {"Aujourd'hui", "Demain"},
+	"es": {"Hoy", "Mañana"},
+	"it": {"Oggi", "Domani"},
+	"pt": {"Hoje", "Amanhã"},
+	"nl": {"Vandaag", "Morgen"},
+	"pl": {"Dzisiaj", "Jutro"},
+}
+
+// weatherLanguage reduces a language tag like "pt-BR" to the base language
+// the labels are keyed by, defaulting to english
+func weatherLanguage(tag string) string {
+	lang := strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if _, ok := conditionLabels[lang]; !ok {
+		return "en"
+	}
+	return lang
+}
+
+func conditionLabel(lang string, code int) string {
+	if label, ok := conditionLabels[lang][code]; ok {
+		return label
+	}
+	return conditionLabels["en"][code]
+}
+
+// conditionLabelPtr labels a code picked out of a response array, which is
+// missing when open-meteo returned fewer entries than asked for
+func conditionLabelPtr(lang string, code *int) string {
+	if code == nil {
+		return ""
+	}
+	return conditionLabel(lang, *code)
+}
+
+func weekdayName(lang string, day time.Weekday) string {
+	names, ok := weekdayNames[lang]
+	if !ok {
+		names = weekdayNames["en"]
+	}
+	return names[day]
+}
+
+// relativeDayName returns "today" for offset 0 and "tomorrow" for 1
+func relativeDayName(lang string, offset int) string {
+	names, ok := relativeDayNames[lang]
+	if !ok {
+		names = relativeDayNames["en"]
+	}
+	return names[offset]
+}
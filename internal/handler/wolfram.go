@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	wolframAPIURL  = "https://api.wolframalpha.com/v2/query"
+	wolframTimeout = "8"
+)
+
+var errWolframNotConfigured = errors.New("wolfram alpha not configured")
+
+var wolframCache = newTTLCache[*wolframQueryResult](6*time.Hour, 500)
+
+type wolframImage struct {
+	Src    string `json:"src"`
+	Alt    string `json:"alt"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type wolframSubpod struct {
+	Title     string        `json:"title"`
+	Plaintext string        `json:"plaintext"`
+	Img       *wolframImage `json:"img"`
+}
+
+type wolframState struct {
+	Name   string         `json:"name"`
+	Input  string         `json:"input"`
+	States []wolframState `json:"states"`
+}
+
+type wolframPod struct {
+	Title      string          `json:"title"`
+	ID         string          `json:"id"`
+	Scanner    string          `json:"scanner"`
+	Position   int             `json:"position"`
+	Primary    bool            `json:"primary"`
+	Error      json.RawMessage `json:"error"`
+	Subpods    []wolframSubpod `json:"subpods"`
+	States     []wolframState  `json:"states"`
+	NumSubpods int             `json:"numsubpods"`
+}
+
+type wolframQueryResult struct {
+	Success     bool            `json:"success"`
+	Error       json.RawMessage `json:"error"`
+	Pods        []wolframPod    `json:"pods"`
+	DidYouMeans json.RawMessage `json:"didyoumeans"`
+}
+
+type wolframResponse struct {
+	QueryResult wolframQueryResult `json:"queryresult"`
+}
+
+func queryWolfram(params url.Values) (*wolframQueryResult, error) {
+	appID := os.Getenv("WOLFRAM_APP_ID")
+	if appID == "" {
+		return nil, errWolframNotConfigured
+	}
+
+	params.Set("output", "json")
+	params.Set("format", "plaintext,image")
+	params.Set("podtimeout", wolframTimeout)
+
+	cacheKey := params.Encode()
+	if cached, ok := wolframCache.get(cacheKey); ok {
+		return cached, nil
+	}
+
+	params.Set("appid", appID)
+
+	var resp wolframResponse
+	if err := fetchJSON(fmt.Sprintf("%s?%s", wolframAPIURL, params.Encode()), &resp); err != nil {
+		return nil, err
+	}
+
+	result := &resp.QueryResult
+	if wolframHasError(result.Error) {
+		return nil, fmt.Errorf("wolfram alpha error: %s", string(result.Error))
+	}
+
+	wolframCache.set(cacheKey, result)
+	return result, nil
+}
+
+// wolframHasError handles the api returning either false or an error object.
+func wolframHasError(raw json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(raw))
+	return trimmed != "" && trimmed != "false" && trimmed != "null"
+}
+
+func flattenWolframStates(states []wolframState) []map[string]interface{} {
+	var flat []map[string]interface{}
+	for _, state := range states {
+		if len(state.States) > 0 {
+			flat = append(flat, flattenWolframStates(state.States)...)
+			continue
+		}
+		flat = append(flat, map[string]interface{}{
+			"name":  state.Name,
+			"input": state.Input,
+		})
+	}
+	return flat
+}
+
+func buildWolframPods(pods []wolframPod) []map[string]interface{} {
+	results := make([]map[string]interface{}, 0, len(pods))
+	for _, pod := range pods {
+		if wolframHasError(pod.Error) {
+			continue
+		}
+
+		subpods := make([]map[string]interface{}, 0, len(pod.Subpods))
+		for _, sub := range pod.Subpods {
+			subpod := map[string]interface{}{
+				"title":     sub.Title,
+				"plaintext": sub.Plaintext,
+			}
+			if sub.Img != nil {
+				subpod["image"] = map[string]interface{}{
+					"url":    sub.Img.Src,
+					"alt":    sub.Img.Alt,
+					"width":  sub.Img.Width,
+					"height": sub.Img.Height,
+				}
+			}
+			subpods = append(subpods, subpod)
+		}
+
+		results = append(results, map[string]interface{}{
+			"id":       pod.ID,
+			"title":    pod.Title,
+			"scanner":  pod.Scanner,
+			"position": pod.Position,
+			"primary":  pod.Primary,
+			"subpods":  subpods,
+			"states":   flattenWolframStates(pod.States),
+		})
+	}
+	return results
+}
+
+func wolframErrorMessage(err error) string {
+	if errors.Is(err, errWolframNotConfigured) {
+		return err.Error()
+	}
+	return "failed to fetch wolfram alpha results"
+}
+
+func SearchWolframAlpha(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	params := url.Values{}
+	params.Set("input", query)
+
+	result, err := queryWolfram(params)
+	if err != nil {
+		rw.writeError(StatusError, wolframErrorMessage(err))
+		return
+	}
+
+	pods := buildWolframPods(result.Pods)
+	if !result.Success || len(pods) == 0 {
+		rw.writeError(StatusNotFound, "no results found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status": StatusSuccess,
+		"query":  query,
+		"pods":   pods,
+	})
+}
+
+func SearchWolframSupplemental(w http.ResponseWriter, r *http.Request) {
+	rw := newResponseWriter(w, time.Now())
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		rw.writeError(StatusError, "missing 'q' query parameter")
+		return
+	}
+
+	podID := r.URL.Query().Get("pod")
+	if podID == "" {
+		rw.writeError(StatusError, "missing 'pod' query parameter")
+		return
+	}
+
+	params := url.Values{}
+	params.Set("input", query)
+	params.Set("includepodid", podID)
+	// the state is usually one of the inputs returned with the pod, for
+	// example "Result__Step-by-step solution"
+	if state := r.URL.Query().Get("state"); state != "" {
+		params.Set("podstate", state)
+	}
+
+	result, err := queryWolfram(params)
+	if err != nil {
+		rw.writeError(StatusError, wolframErrorMessage(err))
+		return
+	}
+
+	pods := buildWolframPods(result.Pods)
+	if !result.Success || len(pods) == 0 {
+		rw.writeError(StatusNotFound, "pod not found")
+		return
+	}
+
+	rw.write(map[string]interface{}{
+		"status": StatusSuccess,
+		"query":  query,
+		"pod":    pods[0],
+	})
+}